@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"go.riyazali.net/sqlite"
+)
+
+// AggregatorFn implements a custom scalar sql function
+// that allows the user to configure an aggregator connection
+// which fans out queries across several configured connections
+type AggregatorFn struct {
+	api SchemaApi
+}
+
+func NewAggregatorFn(api SchemaApi) *AggregatorFn {
+	return &AggregatorFn{
+		api: api,
+	}
+}
+
+func (m *AggregatorFn) Args() int           { return 2 }
+func (m *AggregatorFn) Deterministic() bool { return false }
+func (m *AggregatorFn) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	log.Println("[TRACE] AggregatorFn.Apply start")
+	defer log.Println("[TRACE] AggregatorFn.Apply end")
+
+	connection, children, err := m.getConfig(values...)
+	if err != nil {
+		ctx.ResultError(err)
+		return
+	}
+
+	res, err := m.setAggregatorConfig(connection, children)
+	if err != nil {
+		ctx.ResultError(err)
+		return
+	}
+	setJSONResult(ctx, res)
+}
+
+// getConfig returns the aggregator connection name and the names of its child connections
+// the child connections are passed as a JSON array of connection names or wildcard patterns
+func (m *AggregatorFn) getConfig(values ...sqlite.Value) (connection string, children []string, err error) {
+	log.Println("[TRACE] AggregatorFn.getConfig start")
+	defer log.Println("[TRACE] AggregatorFn.getConfig end")
+
+	if values[0].Type() != sqlite.SQLITE_TEXT || values[1].Type() != sqlite.SQLITE_TEXT {
+		return "", nil, errors.New("expected a TEXT connection name and a TEXT list of connections")
+	}
+
+	connection = values[0].Text()
+	if err := validateConnectionName(connection); err != nil {
+		return "", nil, err
+	}
+
+	children, err = getAggregatorChildren(values[1].Text())
+	if err != nil {
+		return "", nil, err
+	}
+	return connection, children, nil
+}
+
+// getAggregatorChildren resolves the child connections of an aggregator
+// from a JSON array of connection names or wildcard patterns
+func getAggregatorChildren(config string) ([]string, error) {
+	var patterns []string
+	if err := json.Unmarshal([]byte(config), &patterns); err != nil {
+		return nil, fmt.Errorf("expected a JSON array of connection names: %w", err)
+	}
+
+	children, err := resolveConnectionNames(patterns)
+	if err != nil {
+		return nil, err
+	}
+	if len(children) == 0 {
+		return nil, fmt.Errorf("no configured connections match %s", config)
+	}
+	return children, nil
+}
+
+// setAggregatorConfig adds (or updates) the aggregator connection in the plugin
+// and creates the tables of the aggregator
+func (m *AggregatorFn) setAggregatorConfig(connection string, children []string) (*ConfigureResult, error) {
+	log.Println("[TRACE] AggregatorFn.setAggregatorConfig start", connection, children)
+	defer log.Println("[TRACE] AggregatorFn.setAggregatorConfig end", connection, children)
+
+	end, err := beginConfigure(m.api, connection)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
+	c := newAggregatorConnectionConfig(connection, children)
+	cs := []*proto.ConnectionConfig{c}
+
+	existing, exists := getConnection(connection)
+	req := &proto.UpdateConnectionConfigsRequest{Added: cs}
+	if exists {
+		if !existing.IsAggregator() {
+			return nil, fmt.Errorf("connection '%s' is already configured and is not an aggregator", connection)
+		}
+		req = &proto.UpdateConnectionConfigsRequest{Changed: cs}
+	}
+	res, err := pluginServer.UpdateConnectionConfigs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// the aggregator schema is resolved by the plugin from the schemas of the child connections
+	schema, err := getSchema(connection)
+	if err != nil {
+		return nil, err
+	}
+
+	// the set of aggregated tables may have changed along with the child connections
+	if exists {
+		if err := dropTables(existing, m.api); err != nil {
+			return nil, err
+		}
+	}
+	if err := setupTables(connection, schema, m.api); err != nil {
+		return nil, err
+	}
+	current := &Connection{Name: connection, Config: c, Schema: schema, Error: res.GetFailedConnections()[connection]}
+	setConnection(current)
+
+	return NewConfigureResult(existing, current, res.GetFailedConnections()), nil
+}
@@ -3,14 +3,39 @@ package main
 import (
 	"log"
 	"os"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/turbot/go-kit/types"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"golang.org/x/exp/maps"
+	goproto "google.golang.org/protobuf/proto"
 )
 
+// the cache options set at runtime with the steampipe_cache_* functions
+// these take precedence over the environment
+var cacheMut sync.RWMutex
+var cacheOptions = &proto.SetCacheOptionsRequest{
+	Enabled:   true,
+	Ttl:       300,
+	MaxSizeMb: 32,
+}
+var cacheEnabledOverride *bool
+var cacheTTLOverride *int64
+
+// cacheClearedAt holds the time at which the cache of a table was cleared, keyed by connection and table
+// the plugin caches the results of each connection it executes, so the children of an aggregator are keyed, not the aggregator
+var cacheClearedAt = make(map[string]time.Time)
+
 func cacheEnabled() bool {
 	log.Println("[DEBUG] cacheEnabled")
 	defer log.Println("[DEBUG] end cacheEnabled")
+	cacheMut.RLock()
+	defer cacheMut.RUnlock()
+	if cacheEnabledOverride != nil {
+		return *cacheEnabledOverride
+	}
 	if envStr, ok := os.LookupEnv(EnvCacheEnabled); ok {
 		toBool, err := types.ToBool(envStr)
 		if err == nil {
@@ -23,6 +48,11 @@ func cacheEnabled() bool {
 func cacheTTL() int64 {
 	log.Println("[DEBUG] cacheTTL")
 	defer log.Println("[DEBUG] end cacheTTL")
+	cacheMut.RLock()
+	defer cacheMut.RUnlock()
+	if cacheTTLOverride != nil {
+		return *cacheTTLOverride
+	}
 	if envStr, ok := os.LookupEnv(EnvCacheMaxTTL); ok {
 		i64, err := types.ToInt64(envStr)
 		if err == nil {
@@ -31,3 +61,144 @@ func cacheTTL() int64 {
 	}
 	return (int64((10 * time.Hour).Seconds()))
 }
+
+// cacheTTLForTable returns the cache ttl for a query against the given table
+//
+// the plugin only accepts cached results which are younger than the ttl of the request,
+// so if the cache of the table has been cleared, the ttl is capped to the time since it was cleared
+// a query of an aggregator is capped by the last time the table was cleared for any of its children
+func cacheTTLForTable(connection string, table string, ttl int64) int64 {
+	executeConnections := getExecuteConnections(connection)
+	cacheMut.RLock()
+	defer cacheMut.RUnlock()
+	for _, c := range executeConnections {
+		if clearedAt, ok := cacheClearedAt[getCacheKeyForTable(c, table)]; ok {
+			ttl = min(ttl, int64(time.Since(clearedAt).Seconds()))
+		}
+	}
+	return ttl
+}
+
+// getExecuteConnections returns the connections which the plugin executes a query of the given connection against
+func getExecuteConnections(connection string) []string {
+	if c, ok := getConnection(connection); ok {
+		return c.ExecuteConnections()
+	}
+	return []string{connection}
+}
+
+// cacheApplyMut serializes sending the cache options to the plugin, so that the last update wins
+// it is separate from cacheMut, which is read by every query, since the plugin rebuilds its cache
+var cacheApplyMut sync.Mutex
+
+// applyCacheOptions sends the current cache options to the plugin
+// the options (and the overrides set by update) are only kept if the plugin applies them,
+// so that they always describe the cache of the plugin, which the cache stats are estimated from
+// NOTE: this recreates the plugin query cache, so any cached results are lost
+func applyCacheOptions(update func(opts *proto.SetCacheOptionsRequest)) error {
+	cacheApplyMut.Lock()
+	defer cacheApplyMut.Unlock()
+
+	cacheMut.Lock()
+	previousOptions := goproto.Clone(cacheOptions).(*proto.SetCacheOptionsRequest)
+	previousEnabled, previousTTL := cacheEnabledOverride, cacheTTLOverride
+	if update != nil {
+		update(cacheOptions)
+	}
+	opts := goproto.Clone(cacheOptions).(*proto.SetCacheOptionsRequest)
+	cacheMut.Unlock()
+
+	if _, err := pluginServer.SetCacheOptions(opts); err != nil {
+		cacheMut.Lock()
+		cacheOptions = previousOptions
+		cacheEnabledOverride, cacheTTLOverride = previousEnabled, previousTTL
+		cacheMut.Unlock()
+		return err
+	}
+	// the plugin cache has been recreated, so it holds no results
+	cacheMut.Lock()
+	cacheClearedAt = make(map[string]time.Time)
+	cacheMut.Unlock()
+	removeCacheEntries("", "")
+	return nil
+}
+
+func setCacheEnabled(enabled bool) error {
+	return applyCacheOptions(func(opts *proto.SetCacheOptionsRequest) {
+		opts.Enabled = enabled
+		cacheEnabledOverride = &enabled
+	})
+}
+
+func setCacheTTL(ttl int64) error {
+	return applyCacheOptions(func(opts *proto.SetCacheOptionsRequest) {
+		opts.Ttl = ttl
+		cacheTTLOverride = &ttl
+	})
+}
+
+func setCacheMaxSize(maxSizeMb int64) error {
+	return applyCacheOptions(func(opts *proto.SetCacheOptionsRequest) {
+		opts.MaxSizeMb = maxSizeMb
+	})
+}
+
+// clearCache clears the cached results of every configured connection
+func clearCache() error {
+	for _, c := range listConnections() {
+		req := &proto.SetConnectionCacheOptionsRequest{ClearCacheForConnection: c.Name}
+		if _, err := pluginServer.SetConnectionCacheOptions(req); err != nil {
+			return err
+		}
+	}
+	// no results cached before now are left, so the clears of single tables no longer apply
+	cacheMut.Lock()
+	cacheClearedAt = make(map[string]time.Time)
+	cacheMut.Unlock()
+	removeCacheEntries("", "")
+	return clearPersistentCache("")
+}
+
+// clearCacheForTable makes sure that results cached before now are not used for the given table
+// clearing the table of an aggregator clears it for each of its children, and the persistent cache
+// of every connection which shares one of those children is cleared, since it holds their rows
+func clearCacheForTable(connection string, table string) error {
+	executeConnections := getExecuteConnections(connection)
+
+	cacheMut.Lock()
+	now := time.Now()
+	removeExpiredCacheClears(now)
+	for _, c := range executeConnections {
+		cacheClearedAt[getCacheKeyForTable(c, table)] = now
+	}
+	cacheMut.Unlock()
+
+	for _, c := range executeConnections {
+		removeCacheEntries(c, table)
+	}
+	isCleared := func(name string) bool { return slices.Contains(executeConnections, name) }
+	for _, c := range listConnections() {
+		if c.Name != connection && !slices.ContainsFunc(c.ExecuteConnections(), isCleared) {
+			continue
+		}
+		if err := clearPersistentCache(getTableNameForConnection(c.Name, table)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeExpiredCacheClears removes the clear times which no longer cap the ttl of a query
+// the plugin cache expires its results once they are older than its ttl, so any result which was cached
+// before a clear which is older than that has expired
+// removeExpiredCacheClears must be called with cacheMut held
+func removeExpiredCacheClears(now time.Time) {
+	ttl := time.Duration(cacheOptions.Ttl) * time.Second
+	maps.DeleteFunc(cacheClearedAt, func(_ string, clearedAt time.Time) bool {
+		return now.Sub(clearedAt) > ttl
+	})
+}
+
+func getCacheKeyForTable(connection string, table string) string {
+	return connection + "." + table
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"go.riyazali.net/sqlite"
+)
+
+// CacheClearFn implements a custom scalar sql function
+// that clears the cached results of all tables, or of a single table if a table name is given
+type CacheClearFn struct{}
+
+func NewCacheClearFn() *CacheClearFn {
+	return &CacheClearFn{}
+}
+
+func (m *CacheClearFn) Args() int           { return -1 }
+func (m *CacheClearFn) Deterministic() bool { return false }
+func (m *CacheClearFn) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	log.Println("[TRACE] CacheClearFn.Apply start")
+	defer log.Println("[TRACE] CacheClearFn.Apply end")
+
+	switch len(values) {
+	case 0:
+		if err := clearCache(); err != nil {
+			ctx.ResultError(err)
+			return
+		}
+	case 1:
+		if values[0].Type() != sqlite.SQLITE_TEXT {
+			ctx.ResultError(errors.New("expected a TEXT table name"))
+			return
+		}
+		connection, table, ok := findTable(values[0].Text())
+		if !ok {
+			ctx.ResultError(fmt.Errorf("table '%s' does not exist", values[0].Text()))
+			return
+		}
+		if err := clearCacheForTable(connection.Name, table); err != nil {
+			ctx.ResultError(err)
+			return
+		}
+	default:
+		ctx.ResultError(errors.New("expected an optional table name"))
+		return
+	}
+	ctx.ResultInt(1)
+}
+
+// CacheSetTtlFn implements a custom scalar sql function
+// that sets the time (in seconds) for which query results are cached
+// NOTE: this resets the cache
+type CacheSetTtlFn struct{}
+
+func NewCacheSetTtlFn() *CacheSetTtlFn {
+	return &CacheSetTtlFn{}
+}
+
+func (m *CacheSetTtlFn) Args() int           { return 1 }
+func (m *CacheSetTtlFn) Deterministic() bool { return false }
+func (m *CacheSetTtlFn) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	log.Println("[TRACE] CacheSetTtlFn.Apply start")
+	defer log.Println("[TRACE] CacheSetTtlFn.Apply end")
+
+	if values[0].Type() != sqlite.SQLITE_INTEGER || values[0].Int64() <= 0 {
+		ctx.ResultError(errors.New("expected a positive INTEGER number of seconds"))
+		return
+	}
+	if err := setCacheTTL(values[0].Int64()); err != nil {
+		ctx.ResultError(err)
+		return
+	}
+	ctx.ResultInt64(cacheTTL())
+}
+
+// CacheEnableFn implements a custom scalar sql function
+// that enables or disables the query cache
+// NOTE: this resets the cache
+type CacheEnableFn struct{}
+
+func NewCacheEnableFn() *CacheEnableFn {
+	return &CacheEnableFn{}
+}
+
+func (m *CacheEnableFn) Args() int           { return 1 }
+func (m *CacheEnableFn) Deterministic() bool { return false }
+func (m *CacheEnableFn) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	log.Println("[TRACE] CacheEnableFn.Apply start")
+	defer log.Println("[TRACE] CacheEnableFn.Apply end")
+
+	enabled, err := getBoolValue(values[0])
+	if err != nil {
+		ctx.ResultError(err)
+		return
+	}
+	if err := setCacheEnabled(enabled); err != nil {
+		ctx.ResultError(err)
+		return
+	}
+	if cacheEnabled() {
+		ctx.ResultInt(1)
+	} else {
+		ctx.ResultInt(0)
+	}
+}
+
+// getBoolValue converts the argument of a function to a boolean
+// SQLite does not have a boolean type - booleans are stored as the integers 0 and 1,
+// but the text values 'true' and 'false' are accepted as well
+func getBoolValue(v sqlite.Value) (bool, error) {
+	switch v.Type() {
+	case sqlite.SQLITE_INTEGER:
+		return v.Int64() != 0, nil
+	case sqlite.SQLITE_TEXT:
+		switch strings.ToLower(strings.TrimSpace(v.Text())) {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+	}
+	return false, errors.New("expected a BOOLEAN - 1, 0, 'true' or 'false'")
+}
+
+// CacheSetMaxSizeFn implements a custom scalar sql function
+// that sets the maximum size (in megabytes) of the query cache
+// NOTE: this resets the cache
+type CacheSetMaxSizeFn struct{}
+
+func NewCacheSetMaxSizeFn() *CacheSetMaxSizeFn {
+	return &CacheSetMaxSizeFn{}
+}
+
+func (m *CacheSetMaxSizeFn) Args() int           { return 1 }
+func (m *CacheSetMaxSizeFn) Deterministic() bool { return false }
+func (m *CacheSetMaxSizeFn) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	log.Println("[TRACE] CacheSetMaxSizeFn.Apply start")
+	defer log.Println("[TRACE] CacheSetMaxSizeFn.Apply end")
+
+	if values[0].Type() != sqlite.SQLITE_INTEGER || values[0].Int64() <= 0 {
+		ctx.ResultError(errors.New("expected a positive INTEGER number of megabytes"))
+		return
+	}
+	if err := setCacheMaxSize(values[0].Int64()); err != nil {
+		ctx.ResultError(err)
+		return
+	}
+	ctx.ResultInt64(values[0].Int64())
+}
+
+// CachePathFn implements a custom scalar sql function
+// that sets the directory of the persistent cache, and returns the directory in use
+// if no directory is given, the current directory is returned. an empty directory (or NULL) disables it
+type CachePathFn struct{}
+
+func NewCachePathFn() *CachePathFn {
+	return &CachePathFn{}
+}
+
+func (m *CachePathFn) Args() int           { return -1 }
+func (m *CachePathFn) Deterministic() bool { return false }
+func (m *CachePathFn) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	log.Println("[TRACE] CachePathFn.Apply start")
+	defer log.Println("[TRACE] CachePathFn.Apply end")
+
+	switch len(values) {
+	case 0:
+	case 1:
+		var path string
+		switch values[0].Type() {
+		case sqlite.SQLITE_NULL:
+		case sqlite.SQLITE_TEXT:
+			path = values[0].Text()
+		default:
+			ctx.ResultError(errors.New("expected a TEXT directory"))
+			return
+		}
+		if err := setPersistentCachePath(path); err != nil {
+			ctx.ResultError(err)
+			return
+		}
+	default:
+		ctx.ResultError(errors.New("expected an optional directory"))
+		return
+	}
+
+	if path := persistentCachePath(); path != "" {
+		ctx.ResultText(path)
+	} else {
+		ctx.ResultNull()
+	}
+}
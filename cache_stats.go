@@ -0,0 +1,140 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+// the plugin query cache does not expose its statistics, so they are collected by the extension
+// hits and misses are reported by the plugin with each row. entries, bytes and evictions are estimated
+// from the results which this extension saw written to the cache, using the size and ttl limits of the cache -
+// the size of a result is its protobuf size, not the size of the plugin cache entry, and results cached by
+// other processes sharing the plugin cache are not counted
+var cacheStatsMut sync.Mutex
+var cacheTableStatsMap = make(map[string]*cacheTableStats)
+var cacheStatsEntries []*cacheStatsEntry
+
+// cacheTableStats holds the cache statistics of a table of a connection
+type cacheTableStats struct {
+	connection string
+	table      string
+	hits       int64
+	misses     int64
+	evictions  int64
+}
+
+// cacheStatsEntry is a result set which has been written to the cache
+type cacheStatsEntry struct {
+	key     string
+	bytes   int64
+	expires time.Time
+}
+
+func getCacheTableStats(connection string, table string) *cacheTableStats {
+	key := getCacheKeyForTable(connection, table)
+	s, ok := cacheTableStatsMap[key]
+	if !ok {
+		s = &cacheTableStats{connection: connection, table: table}
+		cacheTableStatsMap[key] = s
+	}
+	return s
+}
+
+// recordCacheResult records whether the results of a table were read from the cache
+func recordCacheResult(connection string, table string, hit bool) {
+	cacheStatsMut.Lock()
+	defer cacheStatsMut.Unlock()
+	s := getCacheTableStats(connection, table)
+	if hit {
+		s.hits++
+	} else {
+		s.misses++
+	}
+}
+
+// recordCacheEntry records a result set which has been written to the cache
+// the oldest entries are evicted once the cache is full - as the plugin cache does
+func recordCacheEntry(connection string, table string, bytes int64) {
+	cacheMut.RLock()
+	ttl := time.Duration(cacheOptions.Ttl) * time.Second
+	maxBytes := cacheOptions.MaxSizeMb * 1024 * 1024
+	cacheMut.RUnlock()
+
+	cacheStatsMut.Lock()
+	defer cacheStatsMut.Unlock()
+	removeExpiredCacheEntries()
+	cacheStatsEntries = append(cacheStatsEntries, &cacheStatsEntry{
+		key:     getCacheKeyForTable(connection, table),
+		bytes:   bytes,
+		expires: time.Now().Add(ttl),
+	})
+	for getCacheEntriesBytes() > maxBytes && len(cacheStatsEntries) > 0 {
+		if s, ok := cacheTableStatsMap[cacheStatsEntries[0].key]; ok {
+			s.evictions++
+		}
+		cacheStatsEntries = cacheStatsEntries[1:]
+	}
+}
+
+// removeCacheEntries removes the entries of the given table, or all entries if no table is given
+// this must be called when the cache is cleared
+func removeCacheEntries(connection string, table string) {
+	cacheStatsMut.Lock()
+	defer cacheStatsMut.Unlock()
+	if connection == "" {
+		cacheStatsEntries = nil
+		return
+	}
+	key := getCacheKeyForTable(connection, table)
+	cacheStatsEntries = slices.DeleteFunc(cacheStatsEntries, func(e *cacheStatsEntry) bool {
+		return e.key == key
+	})
+}
+
+// removeExpiredCacheEntries must be called with cacheStatsMut held
+func removeExpiredCacheEntries() {
+	now := time.Now()
+	cacheStatsEntries = slices.DeleteFunc(cacheStatsEntries, func(e *cacheStatsEntry) bool {
+		return e.expires.Before(now)
+	})
+}
+
+// getCacheEntriesBytes must be called with cacheStatsMut held
+func getCacheEntriesBytes() int64 {
+	var bytes int64
+	for _, e := range cacheStatsEntries {
+		bytes += e.bytes
+	}
+	return bytes
+}
+
+func getCacheStatsRows() ([]MetadataRow, error) {
+	cacheStatsMut.Lock()
+	defer cacheStatsMut.Unlock()
+	removeExpiredCacheEntries()
+
+	entries := make(map[string]int64)
+	bytes := make(map[string]int64)
+	for _, e := range cacheStatsEntries {
+		entries[e.key]++
+		bytes[e.key] += e.bytes
+	}
+
+	keys := maps.Keys(cacheTableStatsMap)
+	slices.SortFunc(keys, strings.Compare)
+
+	var rows []MetadataRow
+	for _, key := range keys {
+		s := cacheTableStatsMap[key]
+		var hitRatio any
+		if total := s.hits + s.misses; total > 0 {
+			hitRatio = float64(s.hits) / float64(total)
+		}
+		rows = append(rows, MetadataRow{s.connection, s.table, s.hits, s.misses, hitRatio, entries[key], bytes[key], s.evictions})
+	}
+	return rows, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// resetCacheStats resets the cache statistics for the duration of the test
+func resetCacheStats(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		cacheStatsMut.Lock()
+		cacheTableStatsMap = make(map[string]*cacheTableStats)
+		cacheStatsEntries = nil
+		cacheStatsMut.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// getTestCacheStats returns the estimated entries, bytes and evictions of a table in the cache stats
+func getTestCacheStats(t *testing.T, connection string, table string) (entries int64, bytes int64, evictions int64) {
+	t.Helper()
+	rows, err := getCacheStatsRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if row[0] == connection && row[1] == table {
+			return row[5].(int64), row[6].(int64), row[7].(int64)
+		}
+	}
+	t.Fatalf("the cache stats have no row for %s.%s", connection, table)
+	return 0, 0, 0
+}
+
+// the stats are estimated with the size and ttl of the cache which the plugin applied,
+// so they change once the cache options are changed
+func TestCacheStatsFollowCacheOptions(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name          string
+		maxSizeMb     int64
+		wantEntries   int64
+		wantEvictions int64
+	}{
+		{"cache larger than the results", 32, 3, 0},
+		{"cache smaller than the results", 2, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestPluginServer(t, testPlugin)
+			resetCacheStats(t)
+			recordCacheResult("prod", "test_table", false)
+			recordCacheEntry("prod", "test_table", mb)
+			if err := setCacheMaxSize(tt.maxSizeMb); err != nil {
+				t.Fatal(err)
+			}
+			// changing the options recreates the plugin cache, so the results cached before are gone
+			if entries, _, _ := getTestCacheStats(t, "prod", "test_table"); entries != 0 {
+				t.Fatalf("estimated entries = %d after the cache was recreated, want 0", entries)
+			}
+
+			for range 3 {
+				recordCacheEntry("prod", "test_table", mb)
+			}
+			entries, bytes, evictions := getTestCacheStats(t, "prod", "test_table")
+			if entries != tt.wantEntries || bytes != tt.wantEntries*mb || evictions != tt.wantEvictions {
+				t.Errorf("estimated entries %d, bytes %d, evictions %d - want %d, %d, %d",
+					entries, bytes, evictions, tt.wantEntries, tt.wantEntries*mb, tt.wantEvictions)
+			}
+		})
+	}
+
+	t.Run("ttl", func(t *testing.T) {
+		setTestPluginServer(t, testPlugin)
+		resetCacheStats(t)
+		if err := setCacheTTL(60); err != nil {
+			t.Fatal(err)
+		}
+		recordCacheEntry("prod", "test_table", mb)
+		cacheStatsMut.Lock()
+		expires := cacheStatsEntries[0].expires
+		cacheStatsMut.Unlock()
+		if expires.After(time.Now().Add(time.Minute)) {
+			t.Errorf("the result expires at %v, after the ttl of the cache", expires)
+		}
+	})
+}
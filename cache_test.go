@@ -0,0 +1,133 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"golang.org/x/exp/maps"
+)
+
+// setTestCacheConnections sets the connections prod, dev and the aggregator all of them for the duration of the test
+// and resets the times at which the caches of the tables were cleared when it ends
+func setTestCacheConnections(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		connectionsMut.Lock()
+		connections = make(map[string]*Connection)
+		connectionsMut.Unlock()
+		cacheMut.Lock()
+		cacheClearedAt = make(map[string]time.Time)
+		cacheMut.Unlock()
+	})
+	setConnection(&Connection{Name: "prod", Config: &proto.ConnectionConfig{Connection: "prod"}})
+	setConnection(&Connection{Name: "dev", Config: &proto.ConnectionConfig{Connection: "dev"}})
+	setConnection(&Connection{Name: "all", Config: &proto.ConnectionConfig{Connection: "all", Type: "aggregator", ChildConnections: []string{"dev", "prod"}}})
+}
+
+func TestCacheTTLForTable(t *testing.T) {
+	setTestCacheConnections(t)
+	cacheMut.Lock()
+	cacheClearedAt[getCacheKeyForTable("prod", "aws_s3_bucket")] = time.Now().Add(-time.Minute)
+	cacheMut.Unlock()
+
+	tests := []struct {
+		name       string
+		connection string
+		table      string
+		ttl        int64
+		want       int64
+	}{
+		{"cleared table is capped to the time since it was cleared", "prod", "aws_s3_bucket", 300, 60},
+		{"ttl shorter than the time since clearing", "prod", "aws_s3_bucket", 10, 10},
+		{"fresh data", "prod", "aws_s3_bucket", 0, 0},
+		{"other table of the connection", "prod", "aws_ec2_instance", 300, 300},
+		{"same table of another connection", "dev", "aws_s3_bucket", 300, 300},
+		{"aggregator of the cleared connection", "all", "aws_s3_bucket", 300, 60},
+		{"unknown connection", "test", "aws_s3_bucket", 300, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheTTLForTable(tt.connection, tt.table, tt.ttl); got != tt.want {
+				t.Errorf("cacheTTLForTable(%q, %q, %d) = %d, want %d", tt.connection, tt.table, tt.ttl, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClearCacheForTable(t *testing.T) {
+	tests := []struct {
+		name           string
+		connection     string
+		wantCleared    []string
+		wantCacheFiles []string
+	}{
+		{
+			"connection",
+			"prod",
+			[]string{"prod.aws_s3_bucket"},
+			[]string{"dev_aws_s3_bucket-1.cache", "prod_aws_ec2_instance-1.cache"},
+		},
+		// the plugin caches the results of the children of an aggregator, so these are cleared
+		{
+			"aggregator",
+			"all",
+			[]string{"dev.aws_s3_bucket", "prod.aws_s3_bucket"},
+			[]string{"prod_aws_ec2_instance-1.cache"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestCacheConnections(t)
+			dir := t.TempDir()
+			if err := setPersistentCachePath(dir); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				persistentCacheMut.Lock()
+				persistentCachePathOverride = nil
+				persistentCacheMut.Unlock()
+			})
+			for _, name := range []string{"prod_aws_s3_bucket-1.cache", "dev_aws_s3_bucket-1.cache", "all_aws_s3_bucket-1.cache", "prod_aws_ec2_instance-1.cache"} {
+				writeCacheFile(t, dir, name, 0, 0)
+			}
+
+			if err := clearCacheForTable(tt.connection, "aws_s3_bucket"); err != nil {
+				t.Fatal(err)
+			}
+
+			cacheMut.RLock()
+			cleared := maps.Keys(cacheClearedAt)
+			cacheMut.RUnlock()
+			slices.Sort(cleared)
+			if !slices.Equal(cleared, tt.wantCleared) {
+				t.Errorf("cleared tables = %q, want %q", cleared, tt.wantCleared)
+			}
+			if got := listCacheDir(t, dir); !slices.Equal(got, tt.wantCacheFiles) {
+				t.Errorf("persistent cache files = %q, want %q", got, tt.wantCacheFiles)
+			}
+		})
+	}
+
+	t.Run("clears which are older than the cache ttl are removed", func(t *testing.T) {
+		setTestCacheConnections(t)
+		cacheMut.Lock()
+		ttl := time.Duration(cacheOptions.Ttl) * time.Second
+		cacheClearedAt[getCacheKeyForTable("prod", "aws_ec2_instance")] = time.Now().Add(-ttl - time.Minute)
+		cacheClearedAt[getCacheKeyForTable("dev", "aws_ec2_instance")] = time.Now().Add(-ttl + time.Minute)
+		cacheMut.Unlock()
+
+		if err := clearCacheForTable("prod", "aws_s3_bucket"); err != nil {
+			t.Fatal(err)
+		}
+
+		cacheMut.RLock()
+		cleared := maps.Keys(cacheClearedAt)
+		cacheMut.RUnlock()
+		slices.Sort(cleared)
+		if want := []string{"dev.aws_ec2_instance", "prod.aws_s3_bucket"}; !slices.Equal(cleared, want) {
+			t.Errorf("cleared tables = %q, want %q", cleared, want)
+		}
+	})
+}
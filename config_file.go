@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// the attributes and blocks of a connection block which are used by Steampipe itself
+// these are not part of the config which is passed to the plugin
+var reservedConnectionAttributes = []string{"plugin", "type", "connections", "import_schema"}
+var reservedConnectionBlocks = []string{"options"}
+
+// FileConnection is a connection defined in a Steampipe connection config file
+type FileConnection struct {
+	Name   string
+	Plugin string
+	Type   string
+	// the plugin config of the connection, as HCL (or JSON for JSON config files)
+	Config string
+	// the connections (or wildcard patterns) of an aggregator connection
+	Connections []string
+}
+
+// IsAggregator returns whether this connection aggregates other connections
+func (c *FileConnection) IsAggregator() bool {
+	return c.Type == "aggregator"
+}
+
+// loadConfigFile reads the connections of this plugin from a Steampipe connection config file
+// the file is either a standard .spc file, or its JSON equivalent:
+//
+//	{"connection": {"aws": {"plugin": "aws", "regions": ["*"]}}}
+func loadConfigFile(path string) ([]*FileConnection, error) {
+	log.Println("[TRACE] loadConfigFile start", path)
+	defer log.Println("[TRACE] loadConfigFile end", path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fileConnections []*FileConnection
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		fileConnections, err = parseJsonConfigFile(data)
+	} else {
+		fileConnections, err = parseSpcConfigFile(path, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// a config file may define the connections of several plugins
+	var res []*FileConnection
+	for _, c := range fileConnections {
+		if !isPluginConnection(c) {
+			log.Println("[TRACE] loadConfigFile: skipping connection of another plugin", c.Name, c.Plugin)
+			continue
+		}
+		if err := validateConnectionName(c.Name); err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// parseSpcConfigFile parses the connection blocks of an HCL config file
+// the config of each connection is the source of its attributes and blocks, which the plugin parses itself
+func parseSpcConfigFile(path string, data []byte) ([]*FileConnection, error) {
+	file, diags := hclsyntax.ParseConfig(data, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse config file: %s", diags.Error())
+	}
+
+	var res []*FileConnection
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "connection" || len(block.Labels) != 1 {
+			continue
+		}
+		c := &FileConnection{Name: block.Labels[0]}
+
+		var config []string
+		for name, attr := range block.Body.Attributes {
+			var diags hcl.Diagnostics
+			switch name {
+			case "plugin":
+				diags = gohcl.DecodeExpression(attr.Expr, nil, &c.Plugin)
+			case "type":
+				diags = gohcl.DecodeExpression(attr.Expr, nil, &c.Type)
+			case "connections":
+				diags = gohcl.DecodeExpression(attr.Expr, nil, &c.Connections)
+			}
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("failed to parse connection '%s': %s", c.Name, diags.Error())
+			}
+			if !slices.Contains(reservedConnectionAttributes, name) {
+				config = append(config, string(attr.SrcRange.SliceBytes(data)))
+			}
+		}
+		for _, b := range block.Body.Blocks {
+			if !slices.Contains(reservedConnectionBlocks, b.Type) {
+				config = append(config, string(b.Range().SliceBytes(data)))
+			}
+		}
+		// attributes are held in a map, so sort them to keep the config stable
+		slices.Sort(config)
+		c.Config = strings.Join(config, "\n")
+
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// parseJsonConfigFile parses the connections of a JSON config file
+// the config of each connection is passed to the plugin as JSON
+func parseJsonConfigFile(data []byte) ([]*FileConnection, error) {
+	var file struct {
+		Connection map[string]map[string]json.RawMessage `json:"connection"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	var res []*FileConnection
+	for name, attributes := range file.Connection {
+		c := &FileConnection{Name: name}
+		for attr, target := range map[string]any{"plugin": &c.Plugin, "type": &c.Type, "connections": &c.Connections} {
+			if value, ok := attributes[attr]; ok {
+				if err := json.Unmarshal(value, target); err != nil {
+					return nil, fmt.Errorf("failed to parse connection '%s': invalid %s: %w", name, attr, err)
+				}
+			}
+		}
+		for _, reserved := range append(reservedConnectionAttributes, reservedConnectionBlocks...) {
+			delete(attributes, reserved)
+		}
+		config, err := json.Marshal(attributes)
+		if err != nil {
+			return nil, err
+		}
+		c.Config = string(config)
+		res = append(res, c)
+	}
+	// connections are held in a map, so sort them to configure them in a stable order
+	slices.SortFunc(res, func(a, b *FileConnection) int { return strings.Compare(a.Name, b.Name) })
+	return res, nil
+}
+
+// isPluginConnection returns whether the connection is a connection of this plugin
+// the plugin may be given as a short name (aws), or as an image reference (turbot/aws@latest)
+func isPluginConnection(c *FileConnection) bool {
+	plugin := c.Plugin
+	if i := strings.LastIndex(plugin, "/"); i >= 0 {
+		plugin = plugin[i+1:]
+	}
+	if i := strings.Index(plugin, "@"); i >= 0 {
+		plugin = plugin[:i]
+	}
+	return plugin == pluginAlias
+}
+
+// applyConfigFile configures the connections of this plugin which are defined in the config file
+// aggregators are configured last, since their child connections must be configured first
+func applyConfigFile(fileConnections []*FileConnection, api SchemaApi) ([]*ConfigureResult, error) {
+	log.Println("[TRACE] applyConfigFile start")
+	defer log.Println("[TRACE] applyConfigFile end")
+
+	var results []*ConfigureResult
+
+	configureFn := NewConfigureFn(api)
+	for _, c := range fileConnections {
+		if c.IsAggregator() {
+			continue
+		}
+		res, err := configureFn.setConnectionConfig(c.Name, c.Config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure connection '%s': %w", c.Name, err)
+		}
+		results = append(results, res)
+	}
+
+	aggregatorFn := NewAggregatorFn(api)
+	for _, c := range fileConnections {
+		if !c.IsAggregator() {
+			continue
+		}
+		children, err := resolveConnectionNames(c.Connections)
+		if err != nil {
+			return nil, err
+		}
+		if len(children) == 0 {
+			return nil, fmt.Errorf("failed to configure connection '%s': no configured connections match %s", c.Name, strings.Join(c.Connections, ", "))
+		}
+		res, err := aggregatorFn.setAggregatorConfig(c.Name, children)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure connection '%s': %w", c.Name, err)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
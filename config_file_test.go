@@ -0,0 +1,165 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSpcConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []FileConnection
+		wantErr bool
+	}{
+		{
+			"connection",
+			`
+connection "aws" {
+  plugin  = "aws"
+  regions = ["*"]
+  profile = "prod"
+}
+`,
+			[]FileConnection{{Name: "aws", Plugin: "aws", Config: "profile = \"prod\"\nregions = [\"*\"]"}},
+			false,
+		},
+		{
+			"reserved attributes and blocks are not part of the config",
+			`
+connection "prod" {
+  plugin        = "turbot/aws@latest"
+  import_schema = "enabled"
+  profile       = "prod"
+  options "connection" {
+    cache = true
+  }
+}
+`,
+			[]FileConnection{{Name: "prod", Plugin: "turbot/aws@latest", Config: "profile       = \"prod\""}},
+			false,
+		},
+		{
+			"nested blocks are part of the config",
+			`
+connection "k8s" {
+  plugin = "kubernetes"
+  source_types = ["deployed"]
+  custom_resource_tables = ["*"]
+  manifest_file_paths {
+    paths = ["/tmp"]
+  }
+}
+`,
+			[]FileConnection{{Name: "k8s", Plugin: "kubernetes", Config: "custom_resource_tables = [\"*\"]\nmanifest_file_paths {\n    paths = [\"/tmp\"]\n  }\nsource_types = [\"deployed\"]"}},
+			false,
+		},
+		{
+			"aggregator",
+			`
+connection "all" {
+  plugin      = "aws"
+  type        = "aggregator"
+  connections = ["aws_*"]
+}
+`,
+			[]FileConnection{{Name: "all", Plugin: "aws", Type: "aggregator", Connections: []string{"aws_*"}}},
+			false,
+		},
+		{
+			"other blocks are ignored",
+			`
+options "general" {
+  update_check = false
+}
+connection "aws" {
+  plugin = "aws"
+}
+`,
+			[]FileConnection{{Name: "aws", Plugin: "aws"}},
+			false,
+		},
+		{
+			"invalid hcl",
+			`connection "aws" {`,
+			nil,
+			true,
+		},
+		{
+			"invalid plugin",
+			`
+connection "aws" {
+  plugin = ["aws"]
+}
+`,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSpcConfigFile("test.spc", []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSpcConfigFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseSpcConfigFile() returned %d connections, want %d", len(got), len(tt.want))
+			}
+			for i, c := range got {
+				want := tt.want[i]
+				if c.Name != want.Name || c.Plugin != want.Plugin || c.Type != want.Type || c.Config != want.Config || !slices.Equal(c.Connections, want.Connections) {
+					t.Errorf("parseSpcConfigFile()[%d] = %+v, want %+v", i, *c, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsPluginConnection(t *testing.T) {
+	setPluginAlias(t, "aws")
+	tests := []struct {
+		plugin string
+		want   bool
+	}{
+		{"aws", true},
+		{"turbot/aws", true},
+		{"turbot/aws@latest", true},
+		{"hub.steampipe.io/plugins/turbot/aws@0.100.0", true},
+		{"gcp", false},
+		{"turbot/awsx", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plugin, func(t *testing.T) {
+			if got := isPluginConnection(&FileConnection{Plugin: tt.plugin}); got != tt.want {
+				t.Errorf("isPluginConnection(%q) = %v, want %v", tt.plugin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJsonConfigFile(t *testing.T) {
+	data := `{"connection": {
+		"prod": {"plugin": "aws", "profile": "prod", "options": {"cache": true}},
+		"all": {"plugin": "aws", "type": "aggregator", "connections": ["prod"]}
+	}}`
+	got, err := parseJsonConfigFile([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileConnection{
+		{Name: "all", Plugin: "aws", Type: "aggregator", Connections: []string{"prod"}, Config: "{}"},
+		{Name: "prod", Plugin: "aws", Config: `{"profile":"prod"}`},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseJsonConfigFile() returned %d connections, want %d", len(got), len(want))
+	}
+	for i, c := range got {
+		if c.Name != want[i].Name || c.Plugin != want[i].Plugin || c.Type != want[i].Type || c.Config != want[i].Config || !slices.Equal(c.Connections, want[i].Connections) {
+			t.Errorf("parseJsonConfigFile()[%d] = %+v, want %+v", i, *c, want[i])
+		}
+	}
+
+	if _, err := parseJsonConfigFile([]byte(`{"connection": {"prod": {"plugin": 1}}}`)); err == nil {
+		t.Error("expected an error for an invalid plugin")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"go.riyazali.net/sqlite"
+)
+
+// ConfigureFileFn implements a custom scalar sql function
+// that configures the connections of the plugin from a Steampipe connection config (.spc) file
+// this keeps secrets out of the SQL text
+type ConfigureFileFn struct {
+	api SchemaApi
+}
+
+func NewConfigureFileFn(api SchemaApi) *ConfigureFileFn {
+	return &ConfigureFileFn{
+		api: api,
+	}
+}
+
+func (m *ConfigureFileFn) Args() int           { return 1 }
+func (m *ConfigureFileFn) Deterministic() bool { return false }
+func (m *ConfigureFileFn) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	log.Println("[TRACE] ConfigureFileFn.Apply start")
+	defer log.Println("[TRACE] ConfigureFileFn.Apply end")
+
+	if values[0].Type() != sqlite.SQLITE_TEXT {
+		ctx.ResultError(errors.New("expected a TEXT path to a config file"))
+		return
+	}
+
+	fileConnections, err := loadConfigFile(values[0].Text())
+	if err != nil {
+		ctx.ResultError(err)
+		return
+	}
+	if len(fileConnections) == 0 {
+		ctx.ResultError(errors.New("the config file does not define any connections of this plugin"))
+		return
+	}
+
+	res, err := applyConfigFile(fileConnections, m.api)
+	if err != nil {
+		ctx.ResultError(err)
+		return
+	}
+	setJSONResult(ctx, res)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"go.riyazali.net/sqlite"
@@ -11,45 +12,62 @@ import (
 
 // ConfigureFn implements a custom scalar sql function
 // that allows the user to configure the plugin connection
+// the function has side effects, so it is not deterministic - SQLite must not reuse its result
 type ConfigureFn struct {
-	api *sqlite.ExtensionApi
+	api SchemaApi
 }
 
-func NewConfigureFn(api *sqlite.ExtensionApi) *ConfigureFn {
+func NewConfigureFn(api SchemaApi) *ConfigureFn {
 	return &ConfigureFn{
 		api: api,
 	}
 }
 
-func (m *ConfigureFn) Args() int           { return 1 }
-func (m *ConfigureFn) Deterministic() bool { return true }
+func (m *ConfigureFn) Args() int           { return -1 }
+func (m *ConfigureFn) Deterministic() bool { return false }
 func (m *ConfigureFn) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
 	log.Println("[TRACE] ConfigureFn.Apply start")
 	defer log.Println("[TRACE] ConfigureFn.Apply end")
 
-	var config string
+	var connection, config string
 	var err error
 	log.Println("[TRACE] getting config")
-	if config, err = m.getConfig(values...); err != nil {
+	if connection, config, err = m.getConfig(values...); err != nil {
 		ctx.ResultError(err)
 		return
 	}
 
 	// Set Connection Config
-	err = m.setConnectionConfig(config)
+	res, err := m.setConnectionConfig(connection, config)
 	if err != nil {
 		ctx.ResultError(err)
 		return
 	}
+	setJSONResult(ctx, res)
 }
 
-// getConfig returns the config string from the first argument
-func (m *ConfigureFn) getConfig(values ...sqlite.Value) (config string, err error) {
+// getConfig returns the connection name and the config string from the arguments
+//
+// the function can be called with a single config argument, which configures the default connection
+// or with a connection name followed by the config, which configures (or adds) a named connection
+func (m *ConfigureFn) getConfig(values ...sqlite.Value) (connection string, config string, err error) {
 	log.Println("[TRACE] ConfigureFn.getConfig start")
 	defer log.Println("[TRACE] ConfigureFn.getConfig end")
 
-	if len(values) > 1 {
-		return "", errors.New("expected a single argument")
+	connection = pluginAlias
+	switch len(values) {
+	case 1:
+	case 2:
+		if values[0].Type() != sqlite.SQLITE_TEXT {
+			return "", "", errors.New("expected a TEXT connection name as the first argument")
+		}
+		connection = values[0].Text()
+		if err := validateConnectionName(connection); err != nil {
+			return "", "", err
+		}
+		values = values[1:]
+	default:
+		return "", "", errors.New("expected a config argument, optionally preceded by a connection name")
 	}
 
 	switch {
@@ -58,103 +76,114 @@ func (m *ConfigureFn) getConfig(values ...sqlite.Value) (config string, err erro
 	case values[0].Type() == sqlite.SQLITE_BLOB:
 		config = string(values[0].Blob())
 	default:
-		return "", (errors.New("expected a TEXT or BLOB argument"))
+		return "", "", (errors.New("expected a TEXT or BLOB argument"))
 	}
-	return config, nil
+	return connection, config, nil
 }
 
-// setConnectionConfig sets the connection config for the plugin
-func (m *ConfigureFn) setConnectionConfig(config string) error {
-	log.Println("[TRACE] ConfigureFn.setConnectionConfig start")
-	defer log.Println("[TRACE] ConfigureFn.setConnectionConfig end")
+// setConnectionConfig sets the config of the given connection in the plugin
+// if this is a new connection, it is added to the plugin and its tables are created
+func (m *ConfigureFn) setConnectionConfig(connection string, config string) (*ConfigureResult, error) {
+	log.Println("[TRACE] ConfigureFn.setConnectionConfig start", connection)
+	defer log.Println("[TRACE] ConfigureFn.setConnectionConfig end", connection)
 
-	pluginName := fmt.Sprintf("steampipe-plugin-%s", pluginAlias)
+	end, err := beginConfigure(m.api, connection)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
 
-	c := &proto.ConnectionConfig{
-		Connection:      pluginAlias,
-		Plugin:          pluginName,
-		PluginShortName: pluginAlias,
-		Config:          config,
-		PluginInstance:  pluginName,
+	// the plugin does not report the connections whose config it fails to update, so the config is validated first
+	if res := validateConnectionConfig(config); !res.Valid {
+		return nil, fmt.Errorf("invalid config for connection '%s': %s", connection, strings.Join(res.Errors, "; "))
 	}
 
-	if currentSchema != nil {
+	c := newConnectionConfig(connection, config)
+	cs := []*proto.ConnectionConfig{c}
+
+	// the plugin reports the connections whose config it failed to apply
+	var failedConnections map[string]string
+
+	existing, exists := getConnection(connection)
+	switch {
+	case exists:
 		log.Println("[TRACE] ConfigureFn.setConnectionConfig: updating connection config")
 		// send an update request to the plugin server
-		cs := []*proto.ConnectionConfig{c}
 		req := &proto.UpdateConnectionConfigsRequest{Changed: cs}
-		_, err := pluginServer.UpdateConnectionConfigs(req)
+		res, err := pluginServer.UpdateConnectionConfigs(req)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		failedConnections = res.GetFailedConnections()
+	case hasConnections():
+		log.Println("[TRACE] ConfigureFn.setConnectionConfig: adding connection config")
+		// the plugin already has connections - add this one alongside them
+		req := &proto.UpdateConnectionConfigsRequest{Added: cs}
+		res, err := pluginServer.UpdateConnectionConfigs(req)
+		if err != nil {
+			return nil, err
 		}
-	} else {
+		failedConnections = res.GetFailedConnections()
+	default:
 		log.Println("[TRACE] ConfigureFn.setConnectionConfig: setting connection config")
 		// set the config in the plugin server
-		cs := []*proto.ConnectionConfig{c}
+		// without replacing the query cache - see setInitialConfig
 		req := &proto.SetAllConnectionConfigsRequest{
 			Configs:        cs,
-			MaxCacheSizeMb: 32,
+			MaxCacheSizeMb: -1,
 		}
-		_, err := pluginServer.SetAllConnectionConfigs(req)
+		res, err := pluginServer.SetAllConnectionConfigs(req)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		failedConnections = res.GetFailedConnections()
+		// recreate the query cache with the cache options, and the schema of the connection
+		if err := applyCacheOptions(nil); err != nil {
+			return nil, err
 		}
 	}
 
 	// fetch the schema
-	// we cannot use the global currentSchema variable here
+	// we cannot use the schema stored against the connection here
 	// because it may not have been loaded yet at all
-	schema, err := getSchema()
+	schema, err := getSchema(connection)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	log.Println("[TRACE] ConfigureFn.setConnectionConfig: schema fetched successfully")
 
+	current := &Connection{Name: connection, Config: c, Error: failedConnections[connection]}
+	if exists {
+		current.Schema = existing.Schema
+	}
+
+	// tables need to be (re)created for new connections
 	// we should also trigger a schema refresh after this call for dynamic backends
-	if SCHEMA_MODE_DYNAMIC.Equals(schema.Mode) {
+	if current.Schema == nil || SCHEMA_MODE_DYNAMIC.Equals(schema.Mode) {
 		// drop the existing tables - if they have been created
-		if err := m.dropCurrent(); err != nil {
-			return err
+		if err := dropTables(current, m.api); err != nil {
+			return nil, err
 		}
 
-		// create the tables for the new dynamic schema
-		if err := setupTables(schema, m.api); err != nil {
-			return err
+		// create the tables for the new schema
+		if err := setupTables(connection, schema, m.api); err != nil {
+			return nil, err
 		}
-		currentSchema = schema
+		current.Schema = schema
 	}
+	setConnection(current)
 
-	return err
-}
-
-func (m *ConfigureFn) dropCurrent() error {
-	if currentSchema != nil {
-		sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
-			conn := api.Connection()
-			for tableName := range currentSchema.GetSchema() {
-				log.Println("[TRACE] ConfigureFn.dropCurrent: dropping table", tableName)
-				q := fmt.Sprintf("DROP TABLE %s", tableName)
-				log.Println("[TRACE] ConfigureFn.dropCurrent: executing query", q)
-				err := conn.Exec(q, nil)
-				if err != nil {
-					log.Println("[ERROR] ConfigureFn.dropCurrent: error dropping table", tableName, err)
-					return sqlite.SQLITE_ERROR, err
-				}
-			}
-			return sqlite.SQLITE_OK, nil
-		})
-	}
-	return nil
+	return NewConfigureResult(existing, current, failedConnections), nil
 }
 
-// getSchema returns the schema for the plugin
-func getSchema() (*proto.Schema, error) {
-	log.Println("[TRACE] getSchema start")
-	defer log.Println("[TRACE] getSchema end")
+// getSchema returns the schema of the plugin for the given connection
+func getSchema(connection string) (*proto.Schema, error) {
+	log.Println("[TRACE] getSchema start", connection)
+	defer log.Println("[TRACE] getSchema end", connection)
 
 	// Get Plugin Schema
-	sRequest := &proto.GetSchemaRequest{Connection: pluginAlias}
+	sRequest := &proto.GetSchemaRequest{Connection: connection}
 	s, err := pluginServer.GetSchema(sRequest)
 	if err != nil {
 		return nil, err
@@ -162,9 +191,9 @@ func getSchema() (*proto.Schema, error) {
 	return s.GetSchema(), nil
 }
 
-// setupTables sets up the schema tables for the plugin
-// it fetched the schema from the plugin and then maps it to SQLite tables
-func setupTables(schema *proto.Schema, api *sqlite.ExtensionApi) error {
+// setupTables sets up the schema tables for a connection of the plugin
+// it maps the schema fetched from the plugin to SQLite tables
+func setupTables(connection string, schema *proto.Schema, api SchemaApi) error {
 	log.Println("[TRACE] setupSchemaTables start")
 	defer log.Println("[TRACE] setupSchemaTables end")
 
@@ -173,8 +202,8 @@ func setupTables(schema *proto.Schema, api *sqlite.ExtensionApi) error {
 		// Translate Schema
 		sc := getSQLiteColumnsFromTableSchema(tableSchema)
 
-		current := NewModule(tableName, sc, tableSchema)
-		if err := api.CreateModule(tableName, current, sqlite.ReadOnly(true)); err != nil {
+		current := NewModule(connection, tableName, sc, tableSchema)
+		if err := api.CreateModule(current.tableName, current, sqlite.ReadOnly(true)); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.riyazali.net/sqlite"
+	"golang.org/x/exp/maps"
+)
+
+// testSchemaApi records the tables which are created and dropped
+type testSchemaApi struct {
+	tables        map[string]bool
+	dropErr       error
+	inTransaction bool
+}
+
+func newTestSchemaApi() *testSchemaApi {
+	return &testSchemaApi{tables: make(map[string]bool)}
+}
+
+func (a *testSchemaApi) CreateModule(name string, _ sqlite.Module, _ ...func(*sqlite.ModuleOptions)) error {
+	a.tables[name] = true
+	return nil
+}
+
+func (a *testSchemaApi) DropTable(name string) error {
+	if a.dropErr != nil {
+		return a.dropErr
+	}
+	if !a.tables[name] {
+		return errors.New("no such table: " + name)
+	}
+	delete(a.tables, name)
+	return nil
+}
+
+func (a *testSchemaApi) InTransaction() bool {
+	return a.inTransaction
+}
+
+// getTables returns the names of the tables which have been created, and not dropped
+func (a *testSchemaApi) getTables() []string {
+	tables := maps.Keys(a.tables)
+	slices.Sort(tables)
+	return tables
+}
+
+func TestSetConnectionConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		configs    []string
+		dropErr    error
+		wantTables []string
+		wantErr    string
+	}{
+		{
+			"add",
+			[]string{`tables = ["a", "b"]`},
+			nil,
+			[]string{"prod_a", "prod_b"},
+			"",
+		},
+		{
+			"the tables which are no longer in the schema are dropped",
+			[]string{`tables = ["a", "b"]`, `tables = ["a"]`},
+			nil,
+			[]string{"prod_a"},
+			"",
+		},
+		{
+			"the tables which are added to the schema are created",
+			[]string{`tables = ["a"]`, `tables = ["a", "c"]`},
+			nil,
+			[]string{"prod_a", "prod_c"},
+			"",
+		},
+		{
+			"a table which cannot be dropped fails the change",
+			[]string{`tables = ["a", "b"]`, `tables = ["a"]`},
+			errors.New("database table is locked"),
+			[]string{"prod_a", "prod_b"},
+			"database table is locked",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestPluginServer(t, testDynamicPlugin)
+			api := newTestSchemaApi()
+			configureFn := NewConfigureFn(api)
+
+			var err error
+			for i, config := range tt.configs {
+				if i == len(tt.configs)-1 {
+					api.dropErr = tt.dropErr
+				}
+				if _, err = configureFn.setConnectionConfig("prod", config); err != nil {
+					break
+				}
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("setConnectionConfig() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("setConnectionConfig() error = %v, want %q", err, tt.wantErr)
+			}
+			if got := api.getTables(); !slices.Equal(got, tt.wantTables) {
+				t.Errorf("tables = %q, want %q", got, tt.wantTables)
+			}
+		})
+	}
+
+	t.Run("inside a transaction", func(t *testing.T) {
+		setTestPluginServer(t, testDynamicPlugin)
+		api := newTestSchemaApi()
+		api.inTransaction = true
+		if _, err := NewConfigureFn(api).setConnectionConfig("prod", `tables = ["a"]`); err == nil {
+			t.Fatal("setConnectionConfig() succeeded inside a transaction")
+		}
+		if _, ok := getConnection("prod"); ok || len(api.tables) > 0 {
+			t.Errorf("the connection was configured inside a transaction: tables %q", api.getTables())
+		}
+	})
+}
+
+func TestSetAggregatorConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		dropErr error
+		wantErr bool
+	}{
+		{"fewer child connections", nil, false},
+		{"a table which cannot be dropped fails the change", errors.New("database table is locked"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestPluginServer(t, testPlugin)
+			api := newTestSchemaApi()
+			for _, name := range []string{"prod", "dev"} {
+				if _, err := NewConfigureFn(api).setConnectionConfig(name, ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			aggregatorFn := NewAggregatorFn(api)
+			if _, err := aggregatorFn.setAggregatorConfig("all", []string{"dev", "prod"}); err != nil {
+				t.Fatal(err)
+			}
+
+			api.dropErr = tt.dropErr
+			_, err := aggregatorFn.setAggregatorConfig("all", []string{"prod"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setAggregatorConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if want := []string{"all_test_table", "dev_test_table", "prod_test_table"}; !slices.Equal(api.getTables(), want) {
+				t.Errorf("tables = %q, want %q", api.getTables(), want)
+			}
+			all, _ := getConnection("all")
+			want := []string{"prod"}
+			if tt.wantErr {
+				want = []string{"dev", "prod"}
+			}
+			if got := all.ExecuteConnections(); !slices.Equal(got, want) {
+				t.Errorf("child connections = %q, want %q", got, want)
+			}
+		})
+	}
+}
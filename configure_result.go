@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"go.riyazali.net/sqlite"
+	"golang.org/x/exp/maps"
+)
+
+// ConfigureResult describes a connection which has been configured
+// it is returned as JSON by the configure functions
+type ConfigureResult struct {
+	Connection    string   `json:"connection"`
+	Plugin        string   `json:"plugin"`
+	Type          string   `json:"type,omitempty"`
+	SchemaMode    string   `json:"schema_mode"`
+	Tables        int      `json:"tables"`
+	TablesAdded   []string `json:"tables_added"`
+	TablesRemoved []string `json:"tables_removed"`
+	Warnings      []string `json:"warnings"`
+}
+
+// NewConfigureResult builds the result of configuring a connection
+// previous is the state of the connection before it was configured - nil for a new connection
+// failedConnections is the map of connection errors returned by the plugin
+func NewConfigureResult(previous *Connection, current *Connection, failedConnections map[string]string) *ConfigureResult {
+	res := &ConfigureResult{
+		Connection:    current.Name,
+		Plugin:        current.Config.GetPluginShortName(),
+		Type:          current.Config.GetType(),
+		SchemaMode:    current.Schema.GetMode(),
+		Tables:        len(current.Schema.GetSchema()),
+		TablesAdded:   []string{},
+		TablesRemoved: []string{},
+		Warnings:      []string{},
+	}
+
+	previousTables := make(map[string]struct{})
+	if previous != nil {
+		for tableName := range previous.Schema.GetSchema() {
+			previousTables[previous.TableName(tableName)] = struct{}{}
+		}
+	}
+	currentTables := make(map[string]struct{})
+	for tableName := range current.Schema.GetSchema() {
+		currentTables[current.TableName(tableName)] = struct{}{}
+	}
+	for tableName := range currentTables {
+		if _, ok := previousTables[tableName]; !ok {
+			res.TablesAdded = append(res.TablesAdded, tableName)
+		}
+	}
+	for tableName := range previousTables {
+		if _, ok := currentTables[tableName]; !ok {
+			res.TablesRemoved = append(res.TablesRemoved, tableName)
+		}
+	}
+	slices.Sort(res.TablesAdded)
+	slices.Sort(res.TablesRemoved)
+
+	connectionNames := maps.Keys(failedConnections)
+	slices.Sort(connectionNames)
+	for _, connection := range connectionNames {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("connection '%s': %s", connection, redactSecrets(failedConnections[connection])))
+	}
+	return res
+}
+
+// setJSONResult sets the result of a function to the JSON representation of v
+func setJSONResult(ctx *sqlite.Context, v any) {
+	res, err := json.Marshal(v)
+	if err != nil {
+		ctx.ResultError(err)
+		return
+	}
+	ctx.ResultText(string(res))
+	ctx.ResultSubType(74) // 74 is JSON as per https://github.com/riyaz-ali/sqlite/blob/master/docs/RECIPES.md#json
+}
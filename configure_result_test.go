@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+)
+
+func TestNewConfigureResult(t *testing.T) {
+	previousAlias := pluginAlias
+	pluginAlias = "test"
+	t.Cleanup(func() { pluginAlias = previousAlias })
+
+	connection := func(name string, tables ...string) *Connection {
+		schema := &proto.Schema{Schema: make(map[string]*proto.TableSchema), Mode: "static"}
+		for _, table := range tables {
+			schema.Schema[table] = &proto.TableSchema{}
+		}
+		return &Connection{Name: name, Config: &proto.ConnectionConfig{Connection: name, PluginShortName: "test"}, Schema: schema}
+	}
+
+	tests := []struct {
+		name              string
+		previous          *Connection
+		current           *Connection
+		failedConnections map[string]string
+		want              *ConfigureResult
+	}{
+		{
+			"new connection",
+			nil,
+			connection("prod", "b", "a"),
+			nil,
+			&ConfigureResult{Connection: "prod", Plugin: "test", SchemaMode: "static", Tables: 2, TablesAdded: []string{"prod_a", "prod_b"}, TablesRemoved: []string{}, Warnings: []string{}},
+		},
+		{
+			"new default connection",
+			nil,
+			connection("test", "a"),
+			nil,
+			&ConfigureResult{Connection: "test", Plugin: "test", SchemaMode: "static", Tables: 1, TablesAdded: []string{"a"}, TablesRemoved: []string{}, Warnings: []string{}},
+		},
+		{
+			"changed tables",
+			connection("prod", "a", "b"),
+			connection("prod", "a", "c"),
+			nil,
+			&ConfigureResult{Connection: "prod", Plugin: "test", SchemaMode: "static", Tables: 2, TablesAdded: []string{"prod_c"}, TablesRemoved: []string{"prod_b"}, Warnings: []string{}},
+		},
+		{
+			"unchanged tables",
+			connection("prod", "a"),
+			connection("prod", "a"),
+			nil,
+			&ConfigureResult{Connection: "prod", Plugin: "test", SchemaMode: "static", Tables: 1, TablesAdded: []string{}, TablesRemoved: []string{}, Warnings: []string{}},
+		},
+		{
+			"failed connections are warnings without secrets",
+			nil,
+			connection("prod", "a"),
+			map[string]string{"prod": `invalid token = "abc"`, "dev": "connection refused"},
+			&ConfigureResult{
+				Connection: "prod", Plugin: "test", SchemaMode: "static", Tables: 1, TablesAdded: []string{"prod_a"}, TablesRemoved: []string{},
+				Warnings: []string{"connection 'dev': connection refused", `connection 'prod': invalid token = "<redacted>"`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewConfigureResult(tt.previous, tt.current, tt.failedConnections)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewConfigureResult() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// the configure functions return the result as JSON, in which empty lists are not null
+func TestConfigureResultJSON(t *testing.T) {
+	res := NewConfigureResult(nil, &Connection{Name: "prod", Config: &proto.ConnectionConfig{Connection: "prod"}}, nil)
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"connection":"prod","plugin":"","schema_mode":"","tables":0,"tables_added":[],"tables_removed":[],"warnings":[]}`
+	if string(b) != want {
+		t.Errorf("json = %s, want %s", b, want)
+	}
+}
+
+func TestSetConnectionConfigResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []string
+		want    *ConfigureResult
+		wantErr string
+	}{
+		{
+			"new connection",
+			[]string{`tables = ["a", "b"]`},
+			&ConfigureResult{Connection: "prod", Plugin: "test", SchemaMode: "dynamic", Tables: 2, TablesAdded: []string{"prod_a", "prod_b"}, TablesRemoved: []string{}, Warnings: []string{}},
+			"",
+		},
+		{
+			"changed connection",
+			[]string{`tables = ["a", "b"]`, `tables = ["b", "c"]`},
+			&ConfigureResult{Connection: "prod", Plugin: "test", SchemaMode: "dynamic", Tables: 2, TablesAdded: []string{"prod_c"}, TablesRemoved: []string{"prod_a"}, Warnings: []string{}},
+			"",
+		},
+		{
+			"invalid config",
+			[]string{`tables = "a"`},
+			nil,
+			"invalid config for connection 'prod'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestPluginServer(t, testDynamicPlugin)
+			configureFn := NewConfigureFn(newTestSchemaApi())
+			var got *ConfigureResult
+			var err error
+			for _, config := range tt.configs {
+				if got, err = configureFn.setConnectionConfig("prod", config); err != nil {
+					break
+				}
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("setConnectionConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setConnectionConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setConnectionConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"golang.org/x/exp/maps"
+)
+
+// connectionNameRegex restricts connection names to valid unquoted SQLite identifiers
+// since the name is used as a prefix for the virtual tables of the connection
+var connectionNameRegex = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Connection holds the state of a single plugin connection
+// which has been configured in this extension
+type Connection struct {
+	// the id is assigned when the connection is first stored, and is kept when the connection is updated
+	ID     int64
+	Name   string
+	Config *proto.ConnectionConfig
+	Schema *proto.Schema
+	// the error returned by the plugin when the config was applied (if any)
+	Error     string
+	UpdatedAt time.Time
+}
+
+// TableName returns the name of the SQLite virtual table
+// which exposes the given plugin table for this connection
+func (c *Connection) TableName(table string) string {
+	return getTableNameForConnection(c.Name, table)
+}
+
+// IsAggregator returns whether this connection aggregates other connections
+func (c *Connection) IsAggregator() bool {
+	return c.Config.IsAggregator()
+}
+
+// ExecuteConnections returns the names of the connections which a query against
+// this connection must be executed for
+// for an aggregator, these are its child connections
+func (c *Connection) ExecuteConnections() []string {
+	if c.IsAggregator() {
+		return c.Config.GetChildConnections()
+	}
+	return []string{c.Name}
+}
+
+var connectionsMut sync.RWMutex
+var connections = make(map[string]*Connection)
+var lastConnectionID int64
+
+func getConnection(name string) (*Connection, bool) {
+	connectionsMut.RLock()
+	defer connectionsMut.RUnlock()
+	c, ok := connections[name]
+	return c, ok
+}
+
+// setConnection stores the connection, keeping the id of the connection it replaces (if any)
+func setConnection(c *Connection) {
+	connectionsMut.Lock()
+	defer connectionsMut.Unlock()
+	if existing, ok := connections[c.Name]; ok {
+		c.ID = existing.ID
+	} else {
+		lastConnectionID++
+		c.ID = lastConnectionID
+	}
+	c.UpdatedAt = time.Now()
+	connections[c.Name] = c
+}
+
+func removeConnection(name string) {
+	connectionsMut.Lock()
+	defer connectionsMut.Unlock()
+	delete(connections, name)
+}
+
+func getConnectionByID(id int64) (*Connection, bool) {
+	connectionsMut.RLock()
+	defer connectionsMut.RUnlock()
+	for _, c := range connections {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// listConnections returns all configured connections, ordered by name
+func listConnections() []*Connection {
+	connectionsMut.RLock()
+	defer connectionsMut.RUnlock()
+
+	names := maps.Keys(connections)
+	slices.Sort(names)
+	res := make([]*Connection, 0, len(names))
+	for _, name := range names {
+		res = append(res, connections[name])
+	}
+	return res
+}
+
+// findTable returns the connection and the plugin table name of the given SQLite table
+func findTable(sqliteName string) (connection *Connection, table string, ok bool) {
+	for _, c := range listConnections() {
+		for tableName := range c.Schema.GetSchema() {
+			if c.TableName(tableName) == sqliteName {
+				return c, tableName, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+func hasConnections() bool {
+	connectionsMut.RLock()
+	defer connectionsMut.RUnlock()
+	return len(connections) > 0
+}
+
+// resolveConnectionNames returns the names of the configured (non aggregator) connections
+// which match any of the given names or wildcard patterns - e.g. "aws_*"
+func resolveConnectionNames(patterns []string) ([]string, error) {
+	connectionsMut.RLock()
+	defer connectionsMut.RUnlock()
+
+	var names []string
+	for _, name := range maps.Keys(connections) {
+		if connections[name].IsAggregator() {
+			continue
+		}
+		for _, pattern := range patterns {
+			match, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid connection pattern '%s': %w", pattern, err)
+			}
+			if match {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// validateConnectionName checks that the name can be used as a table prefix
+func validateConnectionName(name string) error {
+	if !connectionNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid connection name '%s': must start with a letter or underscore and contain only lowercase letters, digits and underscores", name)
+	}
+	return nil
+}
+
+// newConnectionConfig builds the proto.ConnectionConfig for a connection of this plugin
+func newConnectionConfig(connection string, config string) *proto.ConnectionConfig {
+	pluginName := fmt.Sprintf("steampipe-plugin-%s", pluginAlias)
+
+	return &proto.ConnectionConfig{
+		Connection:      connection,
+		Plugin:          pluginName,
+		PluginShortName: pluginAlias,
+		Config:          config,
+		PluginInstance:  pluginName,
+	}
+}
+
+// newAggregatorConnectionConfig builds the proto.ConnectionConfig for an aggregator
+// of the given child connections
+func newAggregatorConnectionConfig(connection string, children []string) *proto.ConnectionConfig {
+	c := newConnectionConfig(connection, "")
+	c.Type = "aggregator"
+	c.ChildConnections = children
+	return c
+}
+
+// dropTables drops the SQLite virtual tables which have been created for the connection
+// the first error is returned, so the change to the connection is not applied
+func dropTables(connection *Connection, api SchemaApi) error {
+	if connection.Schema == nil {
+		return nil
+	}
+	for tableName := range connection.Schema.GetSchema() {
+		tableName = connection.TableName(tableName)
+		log.Println("[TRACE] dropTables: dropping table", tableName)
+		if err := api.DropTable(tableName); err != nil {
+			log.Println("[ERROR] dropTables: error dropping table", tableName, err)
+			return fmt.Errorf("failed to drop table %s: %w", tableName, err)
+		}
+	}
+	return nil
+}
+
+// configureMut serializes changes to the configured connections
+// a change updates the plugin, fetches the schema and recreates the tables - these steps must not interleave
+var configureMut sync.Mutex
+
+// openCursorsMut guards the number of open cursors on the tables of each connection,
+// and the connections which are being configured - no cursor may be opened on the tables of these
+var openCursorsMut sync.Mutex
+var openCursors = make(map[string]int)
+var configuringConnections = make(map[string]bool)
+
+// beginConfigure checks that the connection can be configured, and keeps cursors from being opened
+// on its tables until the returned function is called
+//
+// the tables of a connection are dropped and recreated when it is configured, so this is refused
+// inside a transaction, or while a query is reading from the tables of the connection
+func beginConfigure(api SchemaApi, name string) (end func(), err error) {
+	configureMut.Lock()
+	if api.InTransaction() {
+		configureMut.Unlock()
+		return nil, fmt.Errorf("connection '%s' cannot be configured inside a transaction", name)
+	}
+
+	openCursorsMut.Lock()
+	defer openCursorsMut.Unlock()
+	if openCursors[name] > 0 {
+		configureMut.Unlock()
+		return nil, fmt.Errorf("connection '%s' cannot be configured while a query is reading from its tables", name)
+	}
+	configuringConnections[name] = true
+
+	return func() {
+		openCursorsMut.Lock()
+		delete(configuringConnections, name)
+		openCursorsMut.Unlock()
+		configureMut.Unlock()
+	}, nil
+}
+
+// acquireConnections records that a cursor is open on the tables of the connections
+// a cursor on an aggregator table acquires the aggregator and its child connections
+func acquireConnections(names []string) error {
+	openCursorsMut.Lock()
+	defer openCursorsMut.Unlock()
+	for _, name := range names {
+		if configuringConnections[name] {
+			return fmt.Errorf("connection '%s' cannot be queried while it is being configured", name)
+		}
+	}
+	for _, name := range names {
+		openCursors[name]++
+	}
+	return nil
+}
+
+// releaseConnections records that a cursor on the tables of the connections has been closed
+func releaseConnections(names []string) {
+	openCursorsMut.Lock()
+	defer openCursorsMut.Unlock()
+	for _, name := range names {
+		if openCursors[name]--; openCursors[name] <= 0 {
+			delete(openCursors, name)
+		}
+	}
+}
+
+// getCursorConnections returns the connections which a cursor on a table of the connection reads from
+func getCursorConnections(name string) []string {
+	names := []string{name}
+	if c, ok := getConnection(name); ok && c.IsAggregator() {
+		names = append(names, c.ExecuteConnections()...)
+	}
+	return names
+}
+
+// getTableNameForConnection returns the name of the SQLite virtual table for a plugin table
+//
+// tables of the default connection (named after the plugin alias) keep the plugin table name,
+// tables of any other connection are prefixed with the connection name - e.g. prod_aws_s3_bucket
+func getTableNameForConnection(connection string, table string) string {
+	if connection == pluginAlias {
+		return table
+	}
+	return strings.Join([]string{connection, table}, "_")
+}
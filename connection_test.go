@@ -0,0 +1,138 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+)
+
+func TestAcquireConnections(t *testing.T) {
+	t.Cleanup(func() {
+		openCursorsMut.Lock()
+		openCursors = make(map[string]int)
+		configuringConnections = make(map[string]bool)
+		openCursorsMut.Unlock()
+	})
+
+	// a cursor on an aggregator table holds the aggregator and its children
+	if err := acquireConnections([]string{"all", "prod", "dev"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := acquireConnections([]string{"prod"}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]int{"all": 1, "prod": 2, "dev": 1} {
+		if got := openCursors[name]; got != want {
+			t.Errorf("openCursors[%q] = %d, want %d", name, got, want)
+		}
+	}
+
+	releaseConnections([]string{"all", "prod", "dev"})
+	releaseConnections([]string{"prod"})
+	if len(openCursors) != 0 {
+		t.Errorf("expected no open cursors, got %v", openCursors)
+	}
+
+	// no cursor can be opened on a connection which is being configured - nor on its aggregators
+	openCursorsMut.Lock()
+	configuringConnections["prod"] = true
+	openCursorsMut.Unlock()
+	if err := acquireConnections([]string{"all", "prod", "dev"}); err == nil {
+		t.Error("expected an error while the connection is being configured")
+	}
+	if len(openCursors) != 0 {
+		t.Errorf("a refused cursor must not hold any connection, got %v", openCursors)
+	}
+	if err := acquireConnections([]string{"dev"}); err != nil {
+		t.Errorf("unexpected error for a connection which is not being configured: %v", err)
+	}
+}
+
+// setPluginAlias sets the alias of the plugin for the duration of the test
+func setPluginAlias(t *testing.T, alias string) {
+	t.Helper()
+	previous := pluginAlias
+	pluginAlias = alias
+	t.Cleanup(func() { pluginAlias = previous })
+}
+
+func TestGetTableNameForConnection(t *testing.T) {
+	setPluginAlias(t, "aws")
+	tests := []struct {
+		connection string
+		table      string
+		want       string
+	}{
+		{"aws", "aws_s3_bucket", "aws_s3_bucket"},
+		{"prod", "aws_s3_bucket", "prod_aws_s3_bucket"},
+		{"aws_prod", "aws_s3_bucket", "aws_prod_aws_s3_bucket"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.connection, func(t *testing.T) {
+			if got := getTableNameForConnection(tt.connection, tt.table); got != tt.want {
+				t.Errorf("getTableNameForConnection(%q, %q) = %q, want %q", tt.connection, tt.table, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConnectionName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"prod", false},
+		{"_prod", false},
+		{"prod_2", false},
+		{"", true},
+		{"2prod", true},
+		{"Prod", true},
+		{"prod-eu", true},
+		{"prod eu", true},
+		{"prod;drop", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateConnectionName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("validateConnectionName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveConnectionNames(t *testing.T) {
+	t.Cleanup(func() {
+		connectionsMut.Lock()
+		connections = make(map[string]*Connection)
+		connectionsMut.Unlock()
+	})
+	for _, name := range []string{"aws", "aws_prod", "aws_dev", "test"} {
+		setConnection(&Connection{Name: name, Config: &proto.ConnectionConfig{Connection: name}})
+	}
+	setConnection(&Connection{Name: "aws_all", Config: &proto.ConnectionConfig{Connection: "aws_all", Type: "aggregator"}})
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		{"names", []string{"test", "aws"}, []string{"aws", "test"}, false},
+		{"wildcard excludes aggregators", []string{"aws_*"}, []string{"aws_dev", "aws_prod"}, false},
+		{"overlapping patterns", []string{"aws*", "aws_prod"}, []string{"aws", "aws_dev", "aws_prod"}, false},
+		{"no match", []string{"gcp"}, nil, false},
+		{"invalid pattern", []string{"aws_["}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveConnectionNames(tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveConnectionNames(%q) error = %v, wantErr %v", tt.patterns, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("resolveConnectionNames(%q) = %q, want %q", tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
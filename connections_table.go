@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"go.riyazali.net/sqlite"
+)
+
+// the columns of the steampipe_connections table
+// only name, plugin, type and config can be written - the other columns describe the state of the connection
+// NOTE: secrets are masked in the config which is read - an update which leaves the config as it was read keeps
+// the stored config, but a changed config must be written in full, including its secrets
+var connectionsTableColumns = SQLiteColumns{
+	{Name: "name", Type: "TEXT"},
+	{Name: "plugin", Type: "TEXT"},
+	{Name: "type", Type: "TEXT"},
+	{Name: "config", Type: "TEXT"},
+	{Name: "schema_mode", Type: "TEXT"},
+	{Name: "status", Type: "TEXT"},
+	{Name: "last_error", Type: "TEXT"},
+	{Name: "updated_at", Type: "TEXT"},
+}
+
+const (
+	connectionsColumnName = iota
+	connectionsColumnPlugin
+	connectionsColumnType
+	connectionsColumnConfig
+)
+
+// ConnectionsModule implements the writable steampipe_connections table
+// which lists the configured connections - a row is inserted to add a connection,
+// updated to change its config and deleted to remove it
+type ConnectionsModule struct {
+	*MetadataModule
+	api SchemaApi
+}
+
+func NewConnectionsModule(api SchemaApi) *ConnectionsModule {
+	return &ConnectionsModule{
+		MetadataModule: NewMetadataModule("steampipe_connections", connectionsTableColumns, getConnectionsTableRows),
+		api:            api,
+	}
+}
+
+func (m *ConnectionsModule) Connect(_ *sqlite.Conn, _ []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	log.Println("[TRACE] ConnectionsModule.Connect")
+	table := &ConnectionsTable{MetadataTable: &MetadataTable{module: m.MetadataModule}, api: m.api}
+	return table, declare(fmt.Sprintf("CREATE TABLE %s(%s)", m.name, m.columns.DeclarationString()))
+}
+
+// ConnectionsTable is the virtual table of the ConnectionsModule
+// the rowid of a row is the id of the connection, which does not change when the connection is updated
+type ConnectionsTable struct {
+	*MetadataTable
+	api SchemaApi
+}
+
+func (t *ConnectionsTable) Open() (sqlite.VirtualCursor, error) {
+	return &ConnectionsCursor{MetadataCursor: &MetadataCursor{table: t.MetadataTable}}, nil
+}
+
+func (t *ConnectionsTable) Insert(values ...sqlite.Value) (int64, error) {
+	log.Println("[TRACE] ConnectionsTable.Insert")
+
+	row, err := getConnectionsTableRow(values)
+	if err != nil {
+		return 0, err
+	}
+	return t.insert(row)
+}
+
+func (t *ConnectionsTable) Update(rowid sqlite.Value, values ...sqlite.Value) error {
+	log.Println("[TRACE] ConnectionsTable.Update")
+
+	row, err := getConnectionsTableRow(values)
+	if err != nil {
+		return err
+	}
+	return t.update(rowid.Int64(), row)
+}
+
+func (t *ConnectionsTable) Replace(_, _ sqlite.Value, _ ...sqlite.Value) error {
+	return errors.New("connections cannot be renamed")
+}
+
+func (t *ConnectionsTable) Delete(rowid sqlite.Value) error {
+	log.Println("[TRACE] ConnectionsTable.Delete")
+
+	return t.delete(rowid.Int64())
+}
+
+// connectionsTableRow holds the writable columns of a row written to the table
+type connectionsTableRow struct {
+	name           string
+	plugin         string
+	connectionType string
+	config         string
+}
+
+// getConnectionsTableRow reads the writable columns of a row written to the table
+// name and config must be TEXT, plugin and type may also be NULL
+func getConnectionsTableRow(values []sqlite.Value) (*connectionsTableRow, error) {
+	var row connectionsTableRow
+	var err error
+	if row.name, err = getConnectionsTableText(values, connectionsColumnName, false); err != nil {
+		return nil, err
+	}
+	if row.plugin, err = getConnectionsTableText(values, connectionsColumnPlugin, true); err != nil {
+		return nil, err
+	}
+	if row.connectionType, err = getConnectionsTableText(values, connectionsColumnType, true); err != nil {
+		return nil, err
+	}
+	if row.config, err = getConnectionsTableText(values, connectionsColumnConfig, false); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func (t *ConnectionsTable) insert(row *connectionsTableRow) (int64, error) {
+	if _, exists := getConnection(row.name); exists {
+		return 0, fmt.Errorf("connection '%s' already exists", row.name)
+	}
+	return t.configure(row)
+}
+
+func (t *ConnectionsTable) update(id int64, row *connectionsTableRow) error {
+	existing, ok := getConnectionByID(id)
+	if !ok {
+		return fmt.Errorf("connection %d does not exist", id)
+	}
+	if row.name != existing.Name {
+		return errors.New("connections cannot be renamed")
+	}
+	if row.connectionType != existing.Config.GetType() {
+		return errors.New("the type of a connection cannot be changed")
+	}
+	// an update of another column writes back the config as it was read, with its secrets masked
+	// so the stored config is kept unless the config actually changed
+	if row.config == getConnectionsTableConfig(existing) || row.config == existing.Config.GetConfig() {
+		log.Println("[TRACE] ConnectionsTable.update config unchanged", row.name)
+		return nil
+	}
+	_, err := t.configure(row)
+	return err
+}
+
+func (t *ConnectionsTable) delete(id int64) error {
+	c, ok := getConnectionByID(id)
+	if !ok {
+		return fmt.Errorf("connection %d does not exist", id)
+	}
+	return deleteConnection(c, t.api)
+}
+
+// configure adds or updates the connection of the row
+// for an aggregator, the config is the JSON array of its child connections
+func (t *ConnectionsTable) configure(row *connectionsTableRow) (int64, error) {
+	if row.plugin != "" && row.plugin != pluginAlias {
+		return 0, fmt.Errorf("this extension only configures connections of the '%s' plugin", pluginAlias)
+	}
+	// a config copied from the table would replace the secrets of the connection with the mask
+	if strings.Contains(row.config, redactedValue) {
+		return 0, fmt.Errorf("the config contains masked secrets ('%s') - write the config in full, including its secrets", redactedValue)
+	}
+	if err := validateConnectionName(row.name); err != nil {
+		return 0, err
+	}
+
+	switch row.connectionType {
+	case "":
+		if _, err := NewConfigureFn(t.api).setConnectionConfig(row.name, row.config); err != nil {
+			return 0, err
+		}
+	case "aggregator":
+		children, err := getAggregatorChildren(row.config)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := NewAggregatorFn(t.api).setAggregatorConfig(row.name, children); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("invalid connection type '%s'", row.connectionType)
+	}
+
+	c, _ := getConnection(row.name)
+	return c.ID, nil
+}
+
+// ConnectionsCursor iterates the rows of the ConnectionsTable
+type ConnectionsCursor struct {
+	*MetadataCursor
+}
+
+func (c *ConnectionsCursor) Rowid() (int64, error) {
+	name := c.rows[c.currentRow][connectionsColumnName].(string)
+	connection, ok := getConnection(name)
+	if !ok {
+		return 0, fmt.Errorf("connection '%s' does not exist", name)
+	}
+	return connection.ID, nil
+}
+
+func getConnectionsTableRows() ([]MetadataRow, error) {
+	var rows []MetadataRow
+	for _, c := range listConnections() {
+		config := getConnectionsTableConfig(c)
+		status := "ok"
+		var lastError any
+		if c.Error != "" {
+			status = "error"
+			lastError = redactSecrets(c.Error)
+		}
+		rows = append(rows, MetadataRow{
+			c.Name,
+			c.Config.GetPluginShortName(),
+			c.Config.GetType(),
+			config,
+			c.Schema.GetMode(),
+			status,
+			lastError,
+			c.UpdatedAt.Format(SQLITE_TIMESTAMP_FORMAT),
+		})
+	}
+	return rows, nil
+}
+
+// getConnectionsTableConfig returns the config column of the connection: the config with its secrets masked,
+// or the JSON array of the child connections of an aggregator
+func getConnectionsTableConfig(c *Connection) string {
+	if c.IsAggregator() {
+		// a slice of strings always marshals
+		children, _ := json.Marshal(c.Config.GetChildConnections())
+		return string(children)
+	}
+	return redactSecrets(c.Config.GetConfig())
+}
+
+// getConnectionsTableText returns the TEXT value written to the column
+// a NULL value is read as an empty string, if the column may be NULL
+func getConnectionsTableText(values []sqlite.Value, column int, nullable bool) (string, error) {
+	switch values[column].Type() {
+	case sqlite.SQLITE_TEXT:
+		return values[column].Text(), nil
+	case sqlite.SQLITE_NULL:
+		if nullable {
+			return "", nil
+		}
+	}
+	return "", fmt.Errorf("expected a TEXT value for the %s column", connectionsTableColumns[column].Name)
+}
+
+// deleteConnection drops the tables of the connection and removes it from the plugin
+// a connection which is aggregated by another connection cannot be deleted
+func deleteConnection(c *Connection, api SchemaApi) error {
+	log.Println("[TRACE] deleteConnection start", c.Name)
+	defer log.Println("[TRACE] deleteConnection end", c.Name)
+
+	end, err := beginConfigure(api, c.Name)
+	if err != nil {
+		return err
+	}
+	defer end()
+	for _, other := range listConnections() {
+		if other.IsAggregator() && slices.Contains(other.Config.GetChildConnections(), c.Name) {
+			return fmt.Errorf("connection '%s' cannot be deleted while it is aggregated by connection '%s'", c.Name, other.Name)
+		}
+	}
+
+	// the tables are dropped first, so the connection is kept if they cannot be dropped
+	if err := dropTables(c, api); err != nil {
+		return err
+	}
+	req := &proto.UpdateConnectionConfigsRequest{Deleted: []*proto.ConnectionConfig{c.Config}}
+	if _, err := pluginServer.UpdateConnectionConfigs(req); err != nil {
+		return err
+	}
+	removeConnection(c.Name)
+	return nil
+}
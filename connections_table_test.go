@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.riyazali.net/sqlite"
+)
+
+// newTestConnectionsTable returns the steampipe_connections table of a test plugin
+// with the connections prod (whose config has a secret) and all, which aggregates prod
+func newTestConnectionsTable(t *testing.T) (*ConnectionsTable, *testSchemaApi) {
+	t.Helper()
+	setTestPluginServer(t, testPlugin)
+	api := newTestSchemaApi()
+	table := &ConnectionsTable{MetadataTable: &MetadataTable{module: NewConnectionsModule(api).MetadataModule}, api: api}
+	rows := []*connectionsTableRow{
+		{name: "prod", config: `password = "hunter2"`},
+		{name: "all", connectionType: "aggregator", config: `["prod"]`},
+	}
+	for _, row := range rows {
+		if _, err := table.insert(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return table, api
+}
+
+func getTestConnectionID(t *testing.T, name string) int64 {
+	t.Helper()
+	c, ok := getConnection(name)
+	if !ok {
+		t.Fatalf("connection '%s' does not exist", name)
+	}
+	return c.ID
+}
+
+func TestConnectionsTableInsert(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     *connectionsTableRow
+		wantErr string
+	}{
+		{"connection", &connectionsTableRow{name: "dev", plugin: "test", config: ""}, ""},
+		{"aggregator", &connectionsTableRow{name: "any", connectionType: "aggregator", config: `["p*"]`}, ""},
+		{"existing connection", &connectionsTableRow{name: "prod"}, "connection 'prod' already exists"},
+		{"invalid name", &connectionsTableRow{name: "Dev"}, "invalid connection name"},
+		{"other plugin", &connectionsTableRow{name: "dev", plugin: "aws"}, "only configures connections of the 'test' plugin"},
+		{"invalid type", &connectionsTableRow{name: "dev", connectionType: "other"}, "invalid connection type 'other'"},
+		{"masked secrets", &connectionsTableRow{name: "dev", config: `password = "<redacted>"`}, "masked secrets"},
+		{"invalid config", &connectionsTableRow{name: "dev", config: `tables = [`}, "invalid config for connection 'dev'"},
+		{"unknown config key", &connectionsTableRow{name: "dev", config: `region = "us-east-1"`}, "region"},
+		{"aggregator of no connections", &connectionsTableRow{name: "any", connectionType: "aggregator", config: `["gcp*"]`}, "no configured connections match"},
+		{"aggregator config is not a list", &connectionsTableRow{name: "any", connectionType: "aggregator", config: `prod`}, "expected a JSON array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, api := newTestConnectionsTable(t)
+			id, err := table.insert(tt.row)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("insert() error = %v, want %q", err, tt.wantErr)
+				}
+				if tt.row.name != "prod" {
+					if _, ok := getConnection(tt.row.name); ok {
+						t.Errorf("connection '%s' was added", tt.row.name)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("insert() error = %v", err)
+			}
+			if want := getTestConnectionID(t, tt.row.name); id != want {
+				t.Errorf("insert() = %d, want the id of the connection %d", id, want)
+			}
+			if !api.tables[tt.row.name+"_test_table"] {
+				t.Errorf("the tables of the connection were not created: %q", api.getTables())
+			}
+		})
+	}
+}
+
+func TestConnectionsTableUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection string
+		row        *connectionsTableRow
+		wantConfig string
+		wantErr    string
+	}{
+		{"config", "prod", &connectionsTableRow{name: "prod", config: `password = "secret"`}, `password = "secret"`, ""},
+		{"masked config is kept", "prod", &connectionsTableRow{name: "prod", config: `password = "<redacted>"`}, `password = "hunter2"`, ""},
+		{"changed config with masked secrets", "prod", &connectionsTableRow{name: "prod", config: `password = "<redacted>"` + "\n" + `tables = []`}, `password = "hunter2"`, "masked secrets"},
+		{"aggregator", "all", &connectionsTableRow{name: "all", connectionType: "aggregator", config: `["prod", "dev"]`}, `["dev","prod"]`, ""},
+		{"rename", "prod", &connectionsTableRow{name: "dev"}, `password = "hunter2"`, "connections cannot be renamed"},
+		{"change type", "prod", &connectionsTableRow{name: "prod", connectionType: "aggregator", config: `["all"]`}, `password = "hunter2"`, "the type of a connection cannot be changed"},
+		{"invalid config", "prod", &connectionsTableRow{name: "prod", config: `region = "us-east-1"`}, `password = "hunter2"`, "region"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, _ := newTestConnectionsTable(t)
+			if _, err := table.insert(&connectionsTableRow{name: "dev"}); err != nil {
+				t.Fatal(err)
+			}
+			id := getTestConnectionID(t, tt.connection)
+			err := table.update(id, tt.row)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("update() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("update() error = %v", err)
+			}
+			c, _ := getConnection(tt.connection)
+			if c.ID != id {
+				t.Errorf("the id of the connection changed from %d to %d", id, c.ID)
+			}
+			if tt.wantConfig == "" {
+				return
+			}
+			if got := c.Config.GetConfig(); !c.IsAggregator() && got != tt.wantConfig {
+				t.Errorf("config = %q, want %q", got, tt.wantConfig)
+			}
+			if got := getConnectionsTableConfig(c); c.IsAggregator() && got != tt.wantConfig {
+				t.Errorf("config = %q, want %q", got, tt.wantConfig)
+			}
+		})
+	}
+
+	t.Run("unknown connection", func(t *testing.T) {
+		table, _ := newTestConnectionsTable(t)
+		if err := table.update(-1, &connectionsTableRow{name: "prod"}); err == nil {
+			t.Error("update() of an unknown connection succeeded")
+		}
+	})
+}
+
+func TestConnectionsTableReplace(t *testing.T) {
+	table, _ := newTestConnectionsTable(t)
+	var rowid sqlite.Value
+	if err := table.Replace(rowid, rowid); err == nil || err.Error() != "connections cannot be renamed" {
+		t.Errorf("Replace() error = %v, want the connection to be refused", err)
+	}
+}
+
+func TestConnectionsTableDelete(t *testing.T) {
+	tests := []struct {
+		name            string
+		connection      string
+		dropErr         error
+		wantErr         string
+		wantConnections []string
+		wantTables      []string
+	}{
+		{"aggregator", "all", nil, "", []string{"prod"}, []string{"prod_test_table"}},
+		{"aggregated connection", "prod", nil, "aggregated by connection 'all'", []string{"all", "prod"}, []string{"all_test_table", "prod_test_table"}},
+		{"table which cannot be dropped", "all", errors.New("database table is locked"), "database table is locked", []string{"all", "prod"}, []string{"all_test_table", "prod_test_table"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, api := newTestConnectionsTable(t)
+			api.dropErr = tt.dropErr
+			err := table.delete(getTestConnectionID(t, tt.connection))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("delete() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("delete() error = %v", err)
+			}
+			var connections []string
+			for _, c := range listConnections() {
+				connections = append(connections, c.Name)
+			}
+			slices.Sort(connections)
+			if !slices.Equal(connections, tt.wantConnections) {
+				t.Errorf("connections = %q, want %q", connections, tt.wantConnections)
+			}
+			if got := api.getTables(); !slices.Equal(got, tt.wantTables) {
+				t.Errorf("tables = %q, want %q", got, tt.wantTables)
+			}
+			// the connection is kept by the plugin if it was kept by the extension
+			_, err = getSchema(tt.connection)
+			if kept := slices.Contains(tt.wantConnections, tt.connection); (err == nil) != kept {
+				t.Errorf("the plugin schema of the connection: error %v, want the connection kept %v", err, kept)
+			}
+		})
+	}
+
+	t.Run("unknown connection", func(t *testing.T) {
+		table, _ := newTestConnectionsTable(t)
+		if err := table.delete(-1); err == nil {
+			t.Error("delete() of an unknown connection succeeded")
+		}
+	})
+}
@@ -1,11 +1,29 @@
 package main
 
 const (
-	SQLITE_INDEX_CONSTRAINT_LIMIT = 73
-	SQLITE_TIMESTAMP_FORMAT       = "2006-01-02 15:04:05.999"
-	SQLITE_DATEONLY_FORMAT        = "2006-01-02"
-	EnvCacheEnabled               = "STEAMPIPE_CACHE"
-	EnvCacheMaxTTL                = "STEAMPIPE_CACHE_MAX_TTL"
+	SQLITE_INDEX_CONSTRAINT_MATCH     = 64
+	SQLITE_INDEX_CONSTRAINT_LIKE      = 65
+	SQLITE_INDEX_CONSTRAINT_GLOB      = 66
+	SQLITE_INDEX_CONSTRAINT_REGEXP    = 67
+	SQLITE_INDEX_CONSTRAINT_NE        = 68
+	SQLITE_INDEX_CONSTRAINT_ISNOT     = 69
+	SQLITE_INDEX_CONSTRAINT_ISNOTNULL = 70
+	SQLITE_INDEX_CONSTRAINT_ISNULL    = 71
+	SQLITE_INDEX_CONSTRAINT_IS        = 72
+	SQLITE_INDEX_CONSTRAINT_LIMIT     = 73
+	SQLITE_INDEX_CONSTRAINT_OFFSET    = 74
+	SQLITE_INDEX_CONSTRAINT_FUNCTION  = 150
+	SQLITE_INDEX_SCAN_UNIQUE          = 1
+	SQLITE_TIMESTAMP_FORMAT           = "2006-01-02 15:04:05.999"
+	SQLITE_DATEONLY_FORMAT            = "2006-01-02"
+	EnvCacheEnabled                   = "STEAMPIPE_CACHE"
+	EnvCacheMaxTTL                    = "STEAMPIPE_CACHE_MAX_TTL"
+	EnvQueryTimeout                   = "STEAMPIPE_SQLITE_QUERY_TIMEOUT"
+	EnvCachePath                      = "STEAMPIPE_SQLITE_CACHE_PATH"
+	EnvCachePathMaxSize               = "STEAMPIPE_SQLITE_CACHE_PATH_MAX_SIZE_MB"
+	EnvConfigFile                     = "STEAMPIPE_SQLITE_CONFIG_FILE"
+	QUAL_OPERATOR_NOOP                = "NOOP"
+	CACHE_TTL_COLUMN                  = "_cache_ttl"
 )
 
 type SchemaMode string
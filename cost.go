@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// the cost model of a plugin table scan
+//
+// the cost of a scan is dominated by the API calls the plugin makes, so a scan costs
+// one API call per connection plus the cost of every row it returns. the number of rows is estimated
+// from the size of the table and the selectivity of the key column quals pushed down to the plugin
+const (
+	// the cost of the API call(s) made by a get or list call
+	apiCallCost = 100
+	// the cost of returning (and hydrating) a single row
+	rowCost = 1
+	// the number of rows assumed to be returned by a list call, unless the table declares an estimate
+	defaultListRows = 1000
+	// the value of a LIMIT is not known when the query is planned, so a LIMIT is assumed to return this number of rows
+	defaultLimitRows = 100
+	// a plugin table can declare the number of rows returned by its list call with this tag
+	// e.g. Tags: map[string]string{"estimated_rows": "50"}
+	estimatedRowsTag = "estimated_rows"
+)
+
+// CostEstimate is the estimated cost of a plan for a plugin table
+type CostEstimate struct {
+	Cost   float64 `json:"cost"`
+	Rows   int64   `json:"rows"`
+	Unique bool    `json:"unique"`
+}
+
+// getTableDefinition returns the definition of the table in the served plugin, or nil
+// the tables of a plugin with a dynamic schema are only defined per connection, so these are not found
+func getTableDefinition(table string) *plugin.Table {
+	if pluginInstance == nil {
+		return nil
+	}
+	return pluginInstance.TableMap[table]
+}
+
+// getEstimatedRows returns the number of rows which the list call of the table is estimated to return
+// the estimate is declared by the table, and is not learned from the queries of the table - so the plan
+// of a query does not depend on the queries which ran before it
+func getEstimatedRows(table string) int64 {
+	if t := getTableDefinition(table); t != nil {
+		if rows, err := strconv.ParseInt(t.Tags[estimatedRowsTag], 10, 64); err == nil && rows > 0 {
+			return rows
+		}
+	}
+	return defaultListRows
+}
+
+// isGetOnlyTable returns whether the plugin table defines a get call but no list call
+// the table schema does not tell, so this is read from the table definitions of the served plugin
+// the tables of a plugin with a dynamic schema are only defined per connection, and are assumed to have a list call
+func isGetOnlyTable(table string) bool {
+	t := getTableDefinition(table)
+	return t != nil && t.Get != nil && t.List == nil
+}
+
+// QueryStrategy is the plugin call which a query is executed with
+type QueryStrategy string
+
+const (
+	QUERY_STRATEGY_GET  QueryStrategy = "get"
+	QUERY_STRATEGY_LIST QueryStrategy = "list"
+	// the quals satisfy neither the get nor the list call - the plugin fails the query
+	QUERY_STRATEGY_NONE QueryStrategy = "none"
+)
+
+// getQueryStrategy returns the call which the plugin uses for the quals of the query
+// as the plugin does, a get call is preferred whenever its key columns are satisfied
+// a table without a list call can only be queried with a get call
+func (p *PluginTable) getQueryStrategy(qc *QueryContext) QueryStrategy {
+	if p.hasGetCall() && keyColumnsSatisfied(p.tableSchema.GetGetCallKeyColumnList(), qc.Quals) {
+		return QUERY_STRATEGY_GET
+	}
+	if p.getOnly {
+		return QUERY_STRATEGY_NONE
+	}
+	if keyColumnsSatisfied(p.tableSchema.GetListCallKeyColumnList(), qc.Quals) {
+		return QUERY_STRATEGY_LIST
+	}
+	return QUERY_STRATEGY_NONE
+}
+
+// estimateCost estimates the cost of the plan described by the query context
+func (p *PluginTable) estimateCost(qc *QueryContext) *CostEstimate {
+	log.Println("[DEBUG] table.estimateCost start", qc.Strategy)
+	defer log.Println("[DEBUG] table.estimateCost end", qc.Strategy)
+
+	// an aggregator makes the call on each of its child connections
+	connections := p.getConnectionCount()
+
+	switch qc.Strategy {
+	case QUERY_STRATEGY_GET:
+		// a get call fetches a single row from each connection
+		// so only the get call of a single connection returns a unique row
+		return &CostEstimate{
+			Cost:   float64(connections) * (apiCallCost + rowCost),
+			Rows:   connections,
+			Unique: connections == 1 && !p.isAggregator(),
+		}
+	case QUERY_STRATEGY_LIST:
+		// only the quals on the key columns of the list call reduce the rows the plugin fetches
+		// the plugin (or SQLite) filters the fetched rows on any other qual
+		rows := float64(getEstimatedRows(p.name))
+		listKeyColumns := p.tableSchema.GetListCallKeyColumnList()
+		for _, q := range qc.Quals {
+			if isKeyColumnQual(listKeyColumns, q) {
+				rows *= getQualSelectivity(q.Cost)
+			}
+		}
+		if qc.Limit != nil {
+			rows = min(rows, defaultLimitRows)
+		}
+		rows = max(rows, 1)
+		return &CostEstimate{Cost: float64(connections)*apiCallCost + rows*rowCost, Rows: int64(rows)}
+	default:
+		return &CostEstimate{Cost: math.MaxFloat64, Rows: math.MaxInt64}
+	}
+}
+
+// getConnectionCount returns the number of connections the calls of the table are made on
+func (p *PluginTable) getConnectionCount() int64 {
+	c, ok := getConnection(p.connection)
+	if !ok {
+		return 1
+	}
+	return max(int64(len(c.ExecuteConnections())), 1)
+}
+
+func (p *PluginTable) isAggregator() bool {
+	c, ok := getConnection(p.connection)
+	return ok && c.IsAggregator()
+}
+
+// hasGetCall returns whether the table has a get call
+// the plugin adds the optional sp_connection_name key column to the get key columns of every table,
+// even one without a get call, while a get call always has a required (or any_of) key column
+func (p *PluginTable) hasGetCall() bool {
+	return slices.ContainsFunc(p.tableSchema.GetGetCallKeyColumnList(), func(k *proto.KeyColumn) bool {
+		return k.GetRequire() != plugin.Optional
+	})
+}
+
+// keyColumnsSatisfied returns whether the quals provide the key columns required by a call
+func keyColumnsSatisfied(keyColumns []*proto.KeyColumn, quals []*Qual) bool {
+	return len(getMissingKeyColumns(keyColumns, quals)) == 0
+}
+
+// getMissingKeyColumns describes the key columns required by a call which the quals do not provide
+// every required key column must have a qual, and if the call has any_of key columns,
+// at least one of them must have a qual
+func getMissingKeyColumns(keyColumns []*proto.KeyColumn, quals []*Qual) []string {
+	var missing []string
+	var anyOf []string
+	anyOfSatisfied := false
+	for _, keyColumn := range keyColumns {
+		hasQual := slices.ContainsFunc(quals, func(q *Qual) bool { return isKeyColumnQual([]*proto.KeyColumn{keyColumn}, q) })
+		switch keyColumn.GetRequire() {
+		case plugin.Required:
+			if !hasQual {
+				missing = append(missing, fmt.Sprintf("column '%s'", keyColumn.GetName()))
+			}
+		case plugin.AnyOf:
+			anyOf = append(anyOf, fmt.Sprintf("column '%s'", keyColumn.GetName()))
+			anyOfSatisfied = anyOfSatisfied || hasQual
+		}
+		// not concerned about optional columns
+	}
+	if len(anyOf) > 0 && !anyOfSatisfied {
+		missing = append(missing, "any one of "+strings.Join(anyOf, " or "))
+	}
+	return missing
+}
+
+// getMissingKeyColumnsError returns a readable error describing the quals a query needs, if they are missing
+func (p *PluginTable) getMissingKeyColumnsError(qc *QueryContext) error {
+	if qc.Strategy != QUERY_STRATEGY_NONE {
+		return nil
+	}
+	if p.getOnly {
+		return fmt.Errorf("missing required quals: %s (the table only returns single rows)", strings.Join(getMissingKeyColumns(p.tableSchema.GetGetCallKeyColumnList(), qc.Quals), " and "))
+	}
+	msg := fmt.Sprintf("missing required quals: %s", strings.Join(getMissingKeyColumns(p.tableSchema.GetListCallKeyColumnList(), qc.Quals), " and "))
+	if p.hasGetCall() {
+		msg += fmt.Sprintf(" (or for a single row: %s)", strings.Join(getMissingKeyColumns(p.tableSchema.GetGetCallKeyColumnList(), qc.Quals), " and "))
+	}
+	return errors.New(msg)
+}
+
+// isKeyColumnQual returns whether the qual is on one of the key columns, with an operator the key column supports
+func isKeyColumnQual(keyColumns []*proto.KeyColumn, q *Qual) bool {
+	for _, keyColumn := range keyColumns {
+		if keyColumn.GetName() == q.FieldName && slices.Contains(keyColumn.GetOperators(), q.Operator) {
+			return true
+		}
+	}
+	return false
+}
+
+// getQualSelectivity returns the fraction of rows which are assumed to match a qual
+// the cost of the qual operator reflects how selective it is - equality is the most selective
+func getQualSelectivity(operatorCost float64) float64 {
+	switch {
+	case operatorCost <= 1:
+		return 0.1
+	case operatorCost <= 10:
+		return 0.3
+	default:
+		return 0.9
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"go.riyazali.net/sqlite"
+)
+
+func TestEstimateCost(t *testing.T) {
+	t.Cleanup(func() {
+		connectionsMut.Lock()
+		connections = make(map[string]*Connection)
+		connectionsMut.Unlock()
+	})
+	setConnection(&Connection{Name: "prod", Config: &proto.ConnectionConfig{Connection: "prod"}})
+	setConnection(&Connection{Name: "all", Config: &proto.ConnectionConfig{Connection: "all", Type: "aggregator", ChildConnections: []string{"prod", "dev", "test"}}})
+	setPluginInstance(t, &plugin.Plugin{
+		Name: "test",
+		TableMap: map[string]*plugin.Table{
+			"declared_table": {Name: "declared_table", Tags: map[string]string{estimatedRowsTag: "50"}},
+			"invalid_table":  {Name: "invalid_table", Tags: map[string]string{estimatedRowsTag: "many"}},
+		},
+	})
+
+	tableSchema := &proto.TableSchema{
+		GetCallKeyColumnList: []*proto.KeyColumn{
+			{Name: "id", Operators: []string{"="}, Require: "required"},
+		},
+		ListCallKeyColumnList: []*proto.KeyColumn{
+			{Name: "region", Operators: []string{"="}, Require: "optional"},
+		},
+	}
+	regionQual := &Qual{FieldName: "region", Operator: "=", Cost: 1}
+	nameQual := &Qual{FieldName: "name", Operator: "=", Cost: 1}
+
+	tests := []struct {
+		name       string
+		connection string
+		table      string
+		qc         *QueryContext
+		want       CostEstimate
+	}{
+		{
+			"get",
+			"prod", "test_table",
+			&QueryContext{Strategy: QUERY_STRATEGY_GET},
+			CostEstimate{Cost: apiCallCost + rowCost, Rows: 1, Unique: true},
+		},
+		{
+			"aggregator get calls each child",
+			"all", "test_table",
+			&QueryContext{Strategy: QUERY_STRATEGY_GET},
+			CostEstimate{Cost: 3 * (apiCallCost + rowCost), Rows: 3},
+		},
+		{
+			"list of an unscanned table",
+			"prod", "test_table",
+			&QueryContext{Strategy: QUERY_STRATEGY_LIST},
+			CostEstimate{Cost: apiCallCost + defaultListRows*rowCost, Rows: defaultListRows},
+		},
+		{
+			"list of a table which declares its rows",
+			"prod", "declared_table",
+			&QueryContext{Strategy: QUERY_STRATEGY_LIST},
+			CostEstimate{Cost: apiCallCost + 50*rowCost, Rows: 50},
+		},
+		{
+			"list of a table which declares invalid rows",
+			"prod", "invalid_table",
+			&QueryContext{Strategy: QUERY_STRATEGY_LIST},
+			CostEstimate{Cost: apiCallCost + defaultListRows*rowCost, Rows: defaultListRows},
+		},
+		{
+			"key column qual",
+			"prod", "test_table",
+			&QueryContext{Strategy: QUERY_STRATEGY_LIST, Quals: []*Qual{regionQual}},
+			CostEstimate{Cost: apiCallCost + 100*rowCost, Rows: 100},
+		},
+		{
+			"quals on other columns do not reduce the rows fetched",
+			"prod", "test_table",
+			&QueryContext{Strategy: QUERY_STRATEGY_LIST, Quals: []*Qual{nameQual}},
+			CostEstimate{Cost: apiCallCost + defaultListRows*rowCost, Rows: defaultListRows},
+		},
+		{
+			"limit",
+			"prod", "test_table",
+			&QueryContext{Strategy: QUERY_STRATEGY_LIST, Limit: &QueryLimit{}},
+			CostEstimate{Cost: apiCallCost + defaultLimitRows*rowCost, Rows: defaultLimitRows},
+		},
+		{
+			"limit of a table with fewer rows",
+			"prod", "declared_table",
+			&QueryContext{Strategy: QUERY_STRATEGY_LIST, Limit: &QueryLimit{}},
+			CostEstimate{Cost: apiCallCost + 50*rowCost, Rows: 50},
+		},
+		{
+			"aggregator list calls each child",
+			"all", "test_table",
+			&QueryContext{Strategy: QUERY_STRATEGY_LIST},
+			CostEstimate{Cost: 3*apiCallCost + defaultListRows*rowCost, Rows: defaultListRows},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &PluginTable{name: tt.table, connection: tt.connection, tableSchema: tableSchema}
+			if got := table.estimateCost(tt.qc); *got != tt.want {
+				t.Errorf("estimateCost() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	t.Run("no strategy", func(t *testing.T) {
+		table := &PluginTable{name: "test_table", connection: "prod", tableSchema: tableSchema}
+		got := table.estimateCost(&QueryContext{Strategy: QUERY_STRATEGY_NONE})
+		if got.Unique || got.Cost < apiCallCost+defaultListRows*rowCost {
+			t.Errorf("estimateCost() = %+v, want the highest cost", *got)
+		}
+	})
+}
+
+func TestGetQueryStrategy(t *testing.T) {
+	getKeyColumns := []*proto.KeyColumn{
+		{Name: "id", Operators: []string{"="}, Require: "required"},
+	}
+	tests := []struct {
+		name        string
+		tableSchema *proto.TableSchema
+		getOnly     bool
+		quals       []*Qual
+		want        QueryStrategy
+	}{
+		{
+			"get",
+			&proto.TableSchema{GetCallKeyColumnList: getKeyColumns},
+			false,
+			[]*Qual{{FieldName: "id", Operator: "="}},
+			QUERY_STRATEGY_GET,
+		},
+		{
+			"get key column with another operator",
+			&proto.TableSchema{GetCallKeyColumnList: getKeyColumns},
+			false,
+			[]*Qual{{FieldName: "id", Operator: "<>"}},
+			QUERY_STRATEGY_LIST,
+		},
+		{
+			"list without key columns",
+			&proto.TableSchema{GetCallKeyColumnList: getKeyColumns},
+			false,
+			nil,
+			QUERY_STRATEGY_LIST,
+		},
+		// the plugin adds an optional sp_connection_name get key column to a table without a get call
+		{
+			"table without a get call",
+			&proto.TableSchema{GetCallKeyColumnList: []*proto.KeyColumn{{Name: "sp_connection_name", Operators: []string{"="}, Require: "optional"}}},
+			false,
+			[]*Qual{{FieldName: "sp_connection_name", Operator: "="}},
+			QUERY_STRATEGY_LIST,
+		},
+		{
+			"get only table",
+			&proto.TableSchema{GetCallKeyColumnList: getKeyColumns},
+			true,
+			[]*Qual{{FieldName: "id", Operator: "="}},
+			QUERY_STRATEGY_GET,
+		},
+		{
+			"get only table without the get key columns",
+			&proto.TableSchema{GetCallKeyColumnList: getKeyColumns},
+			true,
+			nil,
+			QUERY_STRATEGY_NONE,
+		},
+		{
+			"required list key column",
+			&proto.TableSchema{ListCallKeyColumnList: []*proto.KeyColumn{{Name: "region", Operators: []string{"="}, Require: "required"}}},
+			false,
+			[]*Qual{{FieldName: "region", Operator: "="}},
+			QUERY_STRATEGY_LIST,
+		},
+		{
+			"missing required list key column",
+			&proto.TableSchema{ListCallKeyColumnList: []*proto.KeyColumn{{Name: "region", Operators: []string{"="}, Require: "required"}}},
+			false,
+			nil,
+			QUERY_STRATEGY_NONE,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &PluginTable{name: "test_table", tableSchema: tt.tableSchema, getOnly: tt.getOnly}
+			if got := table.getQueryStrategy(&QueryContext{Quals: tt.quals}); got != tt.want {
+				t.Errorf("getQueryStrategy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMissingKeyColumns(t *testing.T) {
+	keyColumns := []*proto.KeyColumn{
+		{Name: "region", Operators: []string{"="}, Require: "required"},
+		{Name: "id", Operators: []string{"="}, Require: "any_of"},
+		{Name: "name", Operators: []string{"=", "~~*"}, Require: "any_of"},
+		{Name: "status", Operators: []string{"="}, Require: "optional"},
+	}
+	tests := []struct {
+		name  string
+		quals []*Qual
+		want  []string
+	}{
+		{
+			"all satisfied",
+			[]*Qual{{FieldName: "region", Operator: "="}, {FieldName: "name", Operator: "~~*"}},
+			nil,
+		},
+		{
+			"no quals",
+			nil,
+			[]string{"column 'region'", "any one of column 'id' or column 'name'"},
+		},
+		{
+			"any of not satisfied",
+			[]*Qual{{FieldName: "region", Operator: "="}, {FieldName: "status", Operator: "="}},
+			[]string{"any one of column 'id' or column 'name'"},
+		},
+		{
+			"unsupported operator",
+			[]*Qual{{FieldName: "region", Operator: "<>"}, {FieldName: "id", Operator: "="}},
+			[]string{"column 'region'"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getMissingKeyColumns(keyColumns, tt.quals)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("getMissingKeyColumns() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMissingKeyColumnsError(t *testing.T) {
+	getKeyColumns := []*proto.KeyColumn{{Name: "id", Operators: []string{"="}, Require: "required"}}
+	listKeyColumns := []*proto.KeyColumn{{Name: "region", Operators: []string{"="}, Require: "required"}}
+	tests := []struct {
+		name    string
+		table   *PluginTable
+		qc      *QueryContext
+		wantErr string
+	}{
+		{
+			"satisfied",
+			&PluginTable{tableSchema: &proto.TableSchema{ListCallKeyColumnList: listKeyColumns}},
+			&QueryContext{Strategy: QUERY_STRATEGY_LIST},
+			"",
+		},
+		{
+			"list",
+			&PluginTable{tableSchema: &proto.TableSchema{ListCallKeyColumnList: listKeyColumns}},
+			&QueryContext{Strategy: QUERY_STRATEGY_NONE},
+			"missing required quals: column 'region'",
+		},
+		{
+			"list or get",
+			&PluginTable{tableSchema: &proto.TableSchema{GetCallKeyColumnList: getKeyColumns, ListCallKeyColumnList: listKeyColumns}},
+			&QueryContext{Strategy: QUERY_STRATEGY_NONE},
+			"missing required quals: column 'region' (or for a single row: column 'id')",
+		},
+		{
+			"get only",
+			&PluginTable{tableSchema: &proto.TableSchema{GetCallKeyColumnList: getKeyColumns}, getOnly: true},
+			&QueryContext{Strategy: QUERY_STRATEGY_NONE},
+			"missing required quals: column 'id' (the table only returns single rows)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.table.getMissingKeyColumnsError(tt.qc)
+			var got string
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("getMissingKeyColumnsError() = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+// the plan of a query must not depend on the queries which ran before it
+func TestBestIndexIsDeterministic(t *testing.T) {
+	setTestPluginServer(t, testPlugin)
+	if _, err := NewConfigureFn(newTestSchemaApi()).setConnectionConfig("prod", ""); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := getConnection("prod")
+	table := &PluginTable{name: "test_table", connection: "prod", tableSchema: c.Schema.GetSchema()["test_table"]}
+
+	colUsed := int64(1)
+	tests := []struct {
+		name string
+		info *sqlite.IndexInfoInput
+	}{
+		{"scan", &sqlite.IndexInfoInput{ColUsed: &colUsed}},
+		{"limit", &sqlite.IndexInfoInput{ColUsed: &colUsed, Constraints: []*sqlite.IndexConstraint{{ColumnIndex: 0, Op: sqlite.ConstraintOp(SQLITE_INDEX_CONSTRAINT_LIMIT), Usable: true}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := table.BestIndex(tt.info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rows, err := runTestQuery(t, table, tt.info); err != nil || rows != 1 {
+				t.Fatalf("runTestQuery() = %d, %v, want the row of the table", rows, err)
+			}
+			after, err := table.BestIndex(tt.info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if before.EstimatedCost != after.EstimatedCost || before.EstimatedRows != after.EstimatedRows || before.IdxFlags != after.IdxFlags {
+				t.Errorf("the plan changed after running the query: cost %v, rows %d, flags %d before - cost %v, rows %d, flags %d after",
+					before.EstimatedCost, before.EstimatedRows, before.IdxFlags, after.EstimatedCost, after.EstimatedRows, after.IdxFlags)
+			}
+		})
+	}
+}
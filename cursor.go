@@ -3,34 +3,81 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 
 	"github.com/turbot/steampipe-plugin-sdk/v5/anywhere"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"go.riyazali.net/sqlite"
+	goproto "google.golang.org/protobuf/proto"
 )
 
 // PluginCursor implements the sqlite/virtual_table.Cursor interface.
 // It is used to allow the SQLite core to interact with the virtual table and retrieve rows.
 type PluginCursor struct {
+	ctx          context.Context
 	cursorCancel context.CancelFunc
+	execCtx      context.Context
+	execCancel   context.CancelFunc
 	currentRow   int64
 	stream       *anywhere.LocalPluginStream
-	currentItem  map[string]*proto.Column
-	table        *PluginTable
+	// the rows received from the stream of the current execution
+	streamResults <-chan streamResult
+	currentItem   map[string]*proto.Column
+	table         *PluginTable
+	// the connections the cursor reads from - these cannot be configured while the cursor is open
+	connections  []string
+	cacheEnabled bool
+	cacheTTL     int64
+	// the cache results of the current execution, keyed by connection
+	cacheResults map[string]*cursorCacheResult
+	// the rows read from the persistent cache, which are returned instead of executing the query
+	fromPersistentCache bool
+	persistentCacheRows []*proto.Row
+	// the persistent cache key and rows of a query which is not cached yet
+	persistentCacheKey string
+	persistentCacheNew []*proto.Row
+	// the query log entry of the current execution - nil once its outcome is recorded
+	queryLog *QueryLogEntry
+}
+
+// cursorCacheResult tracks whether the rows of a connection were read from the cache
+// and the size of the rows, which the plugin writes to the cache if they were not
+type cursorCacheResult struct {
+	hit   bool
+	bytes int64
+}
+
+// streamResult is a row or an error received from the plugin stream
+type streamResult struct {
+	item *proto.ExecuteResponse
+	err  error
 }
 
 // NewPluginCursor creates a new cursor for a plugin table.
-func NewPluginCursor(ctx context.Context, table *PluginTable) *PluginCursor {
-	_, cancel := context.WithCancel(ctx)
+// The cursor context is cancelled when the cursor is closed, or when the query timeout expires,
+// which stops any plugin execution that is still in flight.
+// A cursor cannot be opened on the tables of a connection which is being configured.
+func NewPluginCursor(ctx context.Context, table *PluginTable) (*PluginCursor, error) {
+	connections := getCursorConnections(table.connection)
+	if err := acquireConnections(connections); err != nil {
+		return nil, err
+	}
+	var cancel context.CancelFunc
+	if timeout := queryTimeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
 	return &PluginCursor{
+		ctx:          ctx,
 		table:        table,
-		stream:       anywhere.NewLocalPluginStream(ctx),
+		connections:  connections,
 		cursorCancel: cancel,
 		currentRow:   0,
 		currentItem:  make(map[string]*proto.Column),
-	}
+	}, nil
 }
 
 // Filter is called by SQLite to restrict the number of rows returned by the virtual table.
@@ -40,24 +87,102 @@ func (p *PluginCursor) Filter(indexNumber int, indexString string, values ...sql
 	log.Println("[DEBUG] cursor.Filter:", p.table.name, indexNumber, indexString, values)
 	defer log.Println("[DEBUG] end cursor.Filter:", p.table.name, indexNumber, indexString, values)
 
+	// SQLite may call Filter several times on the same cursor (e.g. once per row of the outer table in a join)
+	// stop the execution of the previous call and stream the rows of this call on a new stream
+	p.cancelExecution()
+	p.finishQueryLog(QUERY_LOG_STATUS_CLOSED, nil)
+
+	// the query is logged before it is validated, so that the queries which fail are logged too
+	p.queryLog = startQueryLogEntry(p.table.connection, p.table.name)
+	p.currentRow = 0
+	p.cacheResults = make(map[string]*cursorCacheResult)
+	p.fromPersistentCache = false
+
 	queryCtx, err := p.buildQueryContext(indexNumber, indexString, values...)
 	if err != nil {
-		return err
+		return p.filterError(err)
 	}
 
-	qualMap, err := p.buildQualMap(queryCtx, values...)
+	qualValues := make([]any, len(values))
+	for i, v := range values {
+		qualValues[i] = getQualValue(v)
+	}
+	qualMap, err := p.buildQualMap(queryCtx, qualValues...)
 	if err != nil {
-		return err
+		return p.filterError(err)
 	}
 
-	execRequest := p.buildExecuteRequest(pluginAlias, queryCtx, qualMap)
+	execRequest := p.buildExecuteRequest(p.table.connection, queryCtx, qualMap)
+	setQueryLogRequest(p.queryLog, execRequest)
 
-	pluginServer.CallExecuteAsync(execRequest, p.stream)
+	// the plugin cannot execute a query which does not provide the required key columns
+	if err := p.table.getMissingKeyColumnsError(queryCtx); err != nil {
+		return p.filterError(err)
+	}
+
+	p.execCtx, p.execCancel = context.WithCancel(p.ctx)
+	p.cacheEnabled = execRequest.CacheEnabled
+	p.cacheTTL = execRequest.CacheTtl
+
+	if !p.readPersistentCache(execRequest) {
+		p.stream = anywhere.NewLocalPluginStream(p.execCtx)
+		pluginServer.CallExecuteAsync(execRequest, p.stream)
+		p.streamResults = receiveStream(p.execCtx, p.stream)
+	}
 
-	p.currentRow = 0
 	return p.Next()
 }
 
+// readPersistentCache looks up the results of the request in the persistent cache (if enabled)
+// if they are not cached, the key is kept so that the results are written once all rows have been streamed
+func (p *PluginCursor) readPersistentCache(req *proto.ExecuteRequest) bool {
+	p.fromPersistentCache = false
+	p.persistentCacheRows = nil
+	p.persistentCacheKey = ""
+	p.persistentCacheNew = nil
+
+	if !req.CacheEnabled || persistentCachePath() == "" {
+		return false
+	}
+	c, ok := getConnection(p.table.connection)
+	if !ok {
+		return false
+	}
+	key, err := getPersistentCacheKey(c, p.table.name, req.QueryContext)
+	if err != nil {
+		log.Println("[WARN] cursor.readPersistentCache: failed to build cache key", err)
+		return false
+	}
+	if rows, ok := readPersistentCache(key, req.CacheTtl); ok {
+		log.Println("[TRACE] cursor.readPersistentCache: cache hit", key)
+		p.fromPersistentCache = true
+		p.persistentCacheRows = rows
+		return true
+	}
+	p.persistentCacheKey = key
+	return false
+}
+
+// writePersistentCache stores the streamed rows in the persistent cache
+func (p *PluginCursor) writePersistentCache() {
+	if p.persistentCacheKey == "" {
+		return
+	}
+	if err := writePersistentCache(p.persistentCacheKey, p.persistentCacheNew); err != nil {
+		log.Println("[WARN] cursor.writePersistentCache: failed to write cache", err)
+	}
+	p.persistentCacheKey = ""
+	p.persistentCacheNew = nil
+}
+
+// cancelExecution cancels the context of the current plugin execution (if any)
+// the plugin stops any in-flight hydrate calls when this context is cancelled
+func (p *PluginCursor) cancelExecution() {
+	if p.execCancel != nil {
+		p.execCancel()
+	}
+}
+
 func (p *PluginCursor) buildExecuteRequest(alias string, ctx *QueryContext, quals map[string]*proto.Quals) *proto.ExecuteRequest {
 	log.Println("[DEBUG] cursor.buildExecuteRequest")
 	defer log.Println("[DEBUG] end cursor.buildExecuteRequest")
@@ -69,15 +194,15 @@ func (p *PluginCursor) buildExecuteRequest(alias string, ctx *QueryContext, qual
 
 	cacheEnabled := cacheEnabled()
 	cacheTTL := cacheTTL()
+	if ctx.CacheTTL != nil {
+		// the query sets its own cache ttl - a ttl of 0 fetches fresh data, which is then cached
+		cacheTTL = ctx.CacheTTL.Seconds
+	}
+	cacheTTL = cacheTTLForTable(p.table.connection, p.table.name, cacheTTL)
 
-	log.Println("[DEBUG] cursor.buildExecuteRequest", "cacheEnabled", cacheEnabled, "cacheTTL", cacheTTL)
+	log.Printf("[DEBUG] cursor.buildExecuteRequest cacheEnabled %t cacheTTL %d", cacheEnabled, cacheTTL)
 
-	qc := proto.NewQueryContext(ctx.Columns, quals, limitRows, nil)
-	ecd := proto.ExecuteConnectionData{
-		Limit:        qc.Limit,
-		CacheEnabled: cacheEnabled,
-		CacheTtl:     cacheTTL,
-	}
+	qc := proto.NewQueryContext(ctx.Columns, quals, limitRows, ctx.SortOrder)
 	req := proto.ExecuteRequest{
 		Table:                 p.table.name,
 		QueryContext:          qc,
@@ -89,7 +214,20 @@ func (p *PluginCursor) buildExecuteRequest(alias string, ctx *QueryContext, qual
 		CacheEnabled: cacheEnabled,
 		CacheTtl:     cacheTTL,
 	}
-	req.ExecuteConnectionData[alias] = &ecd
+
+	// an aggregator connection fans out the request to all of its child connections
+	// the plugin populates the sp_connection_name column so that the rows can be told apart
+	executeConnections := []string{alias}
+	if c, ok := getConnection(alias); ok {
+		executeConnections = c.ExecuteConnections()
+	}
+	for _, connection := range executeConnections {
+		req.ExecuteConnectionData[connection] = &proto.ExecuteConnectionData{
+			Limit:        qc.Limit,
+			CacheEnabled: cacheEnabled,
+			CacheTtl:     cacheTTL,
+		}
+	}
 	return &req
 }
 
@@ -99,14 +237,25 @@ func (p *PluginCursor) buildExecuteRequest(alias string, ctx *QueryContext, qual
 func (p *PluginCursor) Next() error {
 	log.Println("[DEBUG] cursor.Next")
 	defer log.Println("[DEBUG] end cursor.Next")
-	item, err := p.stream.Recv()
+	item, err := p.recv()
 	if err != nil {
-		return err
+		e := p.queryError(err)
+		p.finishQueryLog(QUERY_LOG_STATUS_ERROR, e)
+		return e
 	}
 	if item == nil {
+		p.finishQueryLog(QUERY_LOG_STATUS_COMPLETE, nil)
 		p.currentRow = -1
+		// all rows have been streamed - release the execution
+		p.cancelExecution()
+		p.recordCacheEntries()
+		p.writePersistentCache()
 		return sqlite.SQLITE_OK
 	}
+	p.recordCacheResult(item)
+	if p.persistentCacheKey != "" {
+		p.persistentCacheNew = append(p.persistentCacheNew, item.Row)
+	}
 
 	p.currentItem = item.Row.Columns
 	p.currentRow++
@@ -114,6 +263,127 @@ func (p *PluginCursor) Next() error {
 	return sqlite.SQLITE_OK
 }
 
+// recordCacheResult records whether the rows of the connection of the item are read from the cache
+// the plugin sets the cache hit metadata on every row, so this is recorded on the first row of each connection
+func (p *PluginCursor) recordCacheResult(item *proto.ExecuteResponse) {
+	result, ok := p.cacheResults[item.Connection]
+	if !ok {
+		result = &cursorCacheResult{hit: item.GetMetadata().GetCacheHit()}
+		p.cacheResults[item.Connection] = result
+		recordCacheResult(item.Connection, p.table.name, result.hit)
+	}
+	if !result.hit {
+		result.bytes += int64(goproto.Size(item.Row))
+	}
+}
+
+// finishQueryLog records the outcome of the current execution in the query log
+func (p *PluginCursor) finishQueryLog(status QueryLogStatus, err error) {
+	if p.queryLog == nil {
+		return
+	}
+	var cacheHit *bool
+	if p.fromPersistentCache {
+		hit := true
+		cacheHit = &hit
+	} else if len(p.cacheResults) > 0 {
+		// the rows of an aggregator are only read from the cache if every connection is a cache hit
+		hit := true
+		for _, result := range p.cacheResults {
+			hit = hit && result.hit
+		}
+		cacheHit = &hit
+	}
+	finishQueryLogEntry(p.queryLog, status, p.currentRow, cacheHit, err)
+	p.queryLog = nil
+}
+
+// recordCacheEntries records the results which the plugin has written to the cache
+// the plugin only caches complete results, so this must be called once all rows have been streamed
+func (p *PluginCursor) recordCacheEntries() {
+	if !p.cacheEnabled {
+		return
+	}
+	for connection, result := range p.cacheResults {
+		if !result.hit {
+			recordCacheEntry(connection, p.table.name, result.bytes)
+		}
+	}
+}
+
+// recv receives the next row from the plugin stream
+// it returns as soon as the execution is cancelled (e.g. the query timeout expires),
+// rather than waiting for the plugin to send the next row
+func (p *PluginCursor) recv() (*proto.ExecuteResponse, error) {
+	if p.fromPersistentCache {
+		if len(p.persistentCacheRows) == 0 {
+			return nil, nil
+		}
+		row := p.persistentCacheRows[0]
+		p.persistentCacheRows = p.persistentCacheRows[1:]
+		return &proto.ExecuteResponse{
+			Row:        row,
+			Metadata:   &proto.QueryMetadata{CacheHit: true},
+			Connection: p.table.connection,
+		}, nil
+	}
+
+	select {
+	case r, ok := <-p.streamResults:
+		if !ok {
+			return nil, nil
+		}
+		return r.item, r.err
+	case <-p.execCtx.Done():
+		return nil, p.execCtx.Err()
+	}
+}
+
+// receiveStream receives the rows of an execution from the plugin stream on a single goroutine
+// the channel is closed once the stream ends or fails
+//
+// the plugin ends the stream with a nil row once all of its connections are done - including when the execution
+// is cancelled - so the goroutine keeps receiving once the context is done, dropping the rows instead of
+// forwarding them. this lets the goroutine return, and keeps the plugin from blocking on a full stream
+// NOTE: LocalPluginStream resets its ready channel in Recv without a lock, so the race detector reports
+// the Send of the plugin and Recv running concurrently
+func receiveStream(ctx context.Context, stream *anywhere.LocalPluginStream) <-chan streamResult {
+	results := make(chan streamResult)
+	go func() {
+		defer close(results)
+		for {
+			item, err := stream.Recv()
+			if ctx.Err() == nil {
+				select {
+				case results <- streamResult{item: item, err: err}:
+				case <-ctx.Done():
+				}
+			}
+			if item == nil || err != nil {
+				return
+			}
+		}
+	}()
+	return results
+}
+
+// queryError wraps an error raised while querying the plugin, so that the error
+// reported by SQLite names the table, connection and column
+// it is also stored as the last error, which is available through steampipe_last_error()
+func (p *PluginCursor) queryError(err error) error {
+	e := NewQueryError(p.table, err)
+	log.Println("[WARN] cursor.queryError:", e)
+	setLastError(e)
+	return e
+}
+
+// filterError records the error of a query which fails before it is executed in the query log, and returns it
+func (p *PluginCursor) filterError(err error) error {
+	e := p.queryError(err)
+	p.finishQueryLog(QUERY_LOG_STATUS_ERROR, e)
+	return e
+}
+
 // Rowid is called by SQLite to retrieve the rowid for the current row.
 func (p *PluginCursor) Rowid() (int64, error) {
 	log.Println("[DEBUG] cursor.RowId")
@@ -127,40 +397,92 @@ func (p *PluginCursor) Rowid() (int64, error) {
 func (p *PluginCursor) Column(context *sqlite.VirtualTableContext, columnIdx int) error {
 	log.Println("[DEBUG] cursor.Column", columnIdx)
 	defer log.Println("[DEBUG] end cursor.Column", columnIdx)
+	if p.table.isCacheTTLColumn(columnIdx) {
+		context.ResultInt64(p.cacheTTL)
+		return nil
+	}
 	column := p.table.tableSchema.Columns[columnIdx]
 
-	log.Println("[TRACE] cursor.Column", "colname", column.Name, "coltype", column.Type)
-	switch column.Type {
-	case proto.ColumnType_BOOL:
-		if p.currentItem[column.Name].GetBoolValue() {
-			context.ResultInt(1)
-		} else {
-			context.ResultInt(0)
-		}
-	case proto.ColumnType_INT:
-		context.ResultInt(int(p.currentItem[column.Name].GetIntValue()))
-	case proto.ColumnType_DOUBLE:
-		context.ResultFloat(p.currentItem[column.Name].GetDoubleValue())
-	case proto.ColumnType_STRING:
-		context.ResultText(p.currentItem[column.Name].GetStringValue())
-	case proto.ColumnType_JSON:
-		context.ResultText(string(p.currentItem[column.Name].GetJsonValue()))
+	log.Printf("[TRACE] cursor.Column colname %s coltype %s", column.Name, column.Type)
+
+	value, err := getColumnValue(column, p.currentItem[column.Name])
+	if err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		context.ResultNull()
+	case int64:
+		context.ResultInt64(v)
+	case float64:
+		context.ResultFloat(v)
+	case string:
+		context.ResultText(v)
+	case jsonValue:
+		context.ResultText(string(v))
 		context.ResultSubType(74) // 74 is JSON as per https://github.com/riyaz-ali/sqlite/blob/master/docs/RECIPES.md#json
-	case proto.ColumnType_DATETIME, proto.ColumnType_TIMESTAMP:
-		context.ResultText(p.currentItem[column.Name].GetTimestampValue().AsTime().Format(SQLITE_TIMESTAMP_FORMAT))
-	case proto.ColumnType_IPADDR:
-		context.ResultText(p.currentItem[column.Name].GetIpAddrValue())
-	case proto.ColumnType_CIDR:
-		context.ResultText(p.currentItem[column.Name].GetCidrRangeValue())
-	case proto.ColumnType_INET:
-		context.ResultText(p.currentItem[column.Name].GetCidrRangeValue())
-	case proto.ColumnType_LTREE:
-		context.ResultText(p.currentItem[column.Name].GetLtreeValue())
 	}
-
 	return nil
 }
 
+// jsonValue is the text of a JSON column, which SQLite is told is JSON
+type jsonValue string
+
+// getColumnValue converts the value of a column of a plugin row to the value returned to SQLite:
+// nil (a SQL NULL), an int64, a float64, a string or a jsonValue
+// a column which is missing from the row, or which holds a null value is a SQL NULL
+// otherwise the Get*Value() methods of the column would return the zero value of the type
+func getColumnValue(column *proto.ColumnDefinition, value *proto.Column) (any, error) {
+	switch v := value.GetValue().(type) {
+	case nil, *proto.Column_NullValue:
+		return nil, nil
+	case *proto.Column_BoolValue:
+		if column.Type == proto.ColumnType_BOOL {
+			if v.BoolValue {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+	case *proto.Column_IntValue:
+		if column.Type == proto.ColumnType_INT {
+			return v.IntValue, nil
+		}
+	case *proto.Column_DoubleValue:
+		if column.Type == proto.ColumnType_DOUBLE {
+			return v.DoubleValue, nil
+		}
+	case *proto.Column_StringValue:
+		if column.Type == proto.ColumnType_STRING {
+			return v.StringValue, nil
+		}
+	case *proto.Column_JsonValue:
+		if column.Type == proto.ColumnType_JSON {
+			return jsonValue(v.JsonValue), nil
+		}
+	case *proto.Column_TimestampValue:
+		if column.Type == proto.ColumnType_DATETIME || column.Type == proto.ColumnType_TIMESTAMP {
+			if v.TimestampValue == nil {
+				return nil, nil
+			}
+			return v.TimestampValue.AsTime().Format(SQLITE_TIMESTAMP_FORMAT), nil
+		}
+	case *proto.Column_IpAddrValue:
+		if column.Type == proto.ColumnType_IPADDR {
+			return v.IpAddrValue, nil
+		}
+	case *proto.Column_CidrRangeValue:
+		if column.Type == proto.ColumnType_CIDR || column.Type == proto.ColumnType_INET {
+			return v.CidrRangeValue, nil
+		}
+	case *proto.Column_LtreeValue:
+		if column.Type == proto.ColumnType_LTREE {
+			return v.LtreeValue, nil
+		}
+	}
+	// the plugin converts the values of a column to the type of the column, so this is a bug in the plugin
+	return nil, fmt.Errorf("column '%s' of type %s holds a value of type %T", column.Name, column.Type, value.GetValue())
+}
+
 // Eof is called by SQLite to determine if the cursor has reached the end of the result set.
 func (p *PluginCursor) Eof() bool {
 	log.Println("[DEBUG] cursor.Eof")
@@ -170,10 +492,15 @@ func (p *PluginCursor) Eof() bool {
 
 // Close is called by SQLite to close the cursor.
 // This method should release any resources held by the cursor.
+// SQLite closes the cursor once it does not need any more rows - the LIMIT is satisfied,
+// the statement is reset or finalized, or the statement is interrupted with sqlite3_interrupt().
+// Cancelling the cursor context stops the plugin from making any further API calls.
 func (p *PluginCursor) Close() error {
 	log.Println("[DEBUG] cursor.Close")
 	defer log.Println("[DEBUG] end cursor.Close")
 	p.cursorCancel()
+	p.finishQueryLog(QUERY_LOG_STATUS_CLOSED, nil)
+	releaseConnections(p.connections)
 	return nil
 }
 
@@ -187,10 +514,27 @@ func (p *PluginCursor) buildQueryContext(_ int, idxStr string, values ...sqlite.
 	}
 
 	p.extractLimitForQueryContext(qc, values...)
+	if err := p.extractCacheTTLForQueryContext(qc, values...); err != nil {
+		return nil, err
+	}
 
 	return qc, nil
 }
 
+func (p *PluginCursor) extractCacheTTLForQueryContext(qc *QueryContext, values ...sqlite.Value) error {
+	log.Println("[DEBUG] cursor.extractCacheTTLForQueryContext")
+	defer log.Println("[DEBUG] end cursor.extractCacheTTLForQueryContext")
+
+	if qc.CacheTTL != nil {
+		v := values[qc.CacheTTL.ArgvIdx-1]
+		if v.Type() != sqlite.SQLITE_INTEGER || v.Int64() < 0 {
+			return fmt.Errorf("invalid value for column '%s': expected a non negative INTEGER number of seconds", CACHE_TTL_COLUMN)
+		}
+		qc.CacheTTL.Seconds = v.Int64()
+	}
+	return nil
+}
+
 func (p *PluginCursor) extractLimitForQueryContext(qc *QueryContext, values ...sqlite.Value) {
 	log.Println("[DEBUG] cursor.extractLimitForQueryContext")
 	defer log.Println("[DEBUG] end cursor.extractLimitForQueryContext")
@@ -208,26 +552,32 @@ func (p *PluginCursor) extractLimitForQueryContext(qc *QueryContext, values ...s
 	}
 }
 
-func (p *PluginCursor) buildQualMap(qc *QueryContext, values ...sqlite.Value) (map[string]*proto.Quals, error) {
+// buildQualMap converts the quals of the query to the quals of the plugin, keyed by column
+// the values are the values of the constraints passed to xFilter (see getQualValue)
+func (p *PluginCursor) buildQualMap(qc *QueryContext, values ...any) (map[string]*proto.Quals, error) {
 	log.Println("[DEBUG] cursor.buildQualMap")
 	defer log.Println("[DEBUG] end cursor.buildQualMap")
 
 	// build the qual map
+	// a column may have several quals - e.g. both bounds of a range - so they are all accumulated
 	qualMap := make(map[string]*proto.Quals)
 	for _, qual := range qc.Quals {
 		mappedValue, err := getMappedQualValue(values[qual.ArgvIndex-1], qual)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("invalid value for column '%s': %w", qual.FieldName, err)
+		}
+		if mappedValue == nil {
+			log.Println("[TRACE] cursor.buildQualMap: qual cannot be passed to the plugin", qual.FieldName, qual.Operator)
+			continue
 		}
-		qualMap[qual.FieldName] = &proto.Quals{
-			Quals: []*proto.Qual{
-				{
-					FieldName: qual.FieldName,
-					Operator:  &proto.Qual_StringValue{StringValue: qual.Operator},
-					Value:     mappedValue,
-				},
-			},
+		if _, ok := qualMap[qual.FieldName]; !ok {
+			qualMap[qual.FieldName] = &proto.Quals{}
 		}
+		qualMap[qual.FieldName].Append(&proto.Qual{
+			FieldName: qual.FieldName,
+			Operator:  &proto.Qual_StringValue{StringValue: qual.Operator},
+			Value:     mappedValue,
+		})
 	}
 	return qualMap, nil
 }
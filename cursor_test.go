@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/anywhere"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"go.riyazali.net/sqlite"
+	goproto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// waitForClose waits for the results channel to be closed, discarding any results
+func waitForClose(t *testing.T, results <-chan streamResult) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-results:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("the receiver goroutine did not return")
+		}
+	}
+}
+
+func TestReceiveStream(t *testing.T) {
+	t.Run("rows then end of stream", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream := anywhere.NewLocalPluginStream(ctx)
+		results := receiveStream(ctx, stream)
+
+		_ = stream.Send(&proto.ExecuteResponse{Row: &proto.Row{}})
+		_ = stream.Send(nil)
+
+		if r := <-results; r.item == nil || r.err != nil {
+			t.Fatalf("expected a row, got %v, %v", r.item, r.err)
+		}
+		if r := <-results; r.item != nil || r.err != nil {
+			t.Fatalf("expected the end of the stream, got %v, %v", r.item, r.err)
+		}
+		waitForClose(t, results)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream := anywhere.NewLocalPluginStream(ctx)
+		results := receiveStream(ctx, stream)
+
+		stream.Error(errors.New("plugin error"))
+
+		if r := <-results; r.err == nil || r.err.Error() != "plugin error" {
+			t.Fatalf("expected the plugin error, got %v, %v", r.item, r.err)
+		}
+		waitForClose(t, results)
+	})
+
+	t.Run("cancel while waiting for a row", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := anywhere.NewLocalPluginStream(ctx)
+		results := receiveStream(ctx, stream)
+		pluginDone := runTestPlugin(ctx, stream, 0)
+		cancel()
+		waitForPlugin(t, pluginDone)
+		waitForClose(t, results)
+	})
+
+	// the plugin must not block on a full stream once the rows are no longer read
+	t.Run("cancel with more unread rows than the stream buffers", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := anywhere.NewLocalPluginStream(ctx)
+		results := receiveStream(ctx, stream)
+		pluginDone := runTestPlugin(ctx, stream, 5000)
+		<-results
+		cancel()
+		waitForPlugin(t, pluginDone)
+		waitForClose(t, results)
+	})
+}
+
+// runTestPlugin sends rows to the stream as the plugin does: until it has sent them all, or the
+// execution is cancelled, and then a nil row to end the stream
+// the returned channel is closed once the plugin has ended the stream
+func runTestPlugin(ctx context.Context, stream *anywhere.LocalPluginStream, rows int) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < rows && ctx.Err() == nil; i++ {
+			_ = stream.Send(&proto.ExecuteResponse{Row: &proto.Row{}})
+		}
+		<-ctx.Done()
+		_ = stream.Send(nil)
+	}()
+	return done
+}
+
+func waitForPlugin(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the plugin is blocked on the stream")
+	}
+}
+
+// runTestQuery plans a query of the table with the given constraints (all of which are null) and reads all of its rows
+func runTestQuery(t *testing.T, table *PluginTable, info *sqlite.IndexInfoInput) (rows int, err error) {
+	t.Helper()
+	plan, err := table.BestIndex(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := table.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+	values := make([]sqlite.Value, len(info.Constraints))
+	for err = cursor.Filter(plan.IndexNumber, plan.IndexString, values...); isTestCursorOK(err) && !cursor.Eof(); err = cursor.Next() {
+		rows++
+	}
+	if isTestCursorOK(err) {
+		err = nil
+	}
+	return rows, err
+}
+
+// isTestCursorOK returns whether the error of a cursor call is a success - the cursor returns SQLITE_OK when it succeeds
+func isTestCursorOK(err error) bool {
+	return err == nil || errors.Is(err, sqlite.SQLITE_OK)
+}
+
+func TestBuildExecuteRequestCacheTTL(t *testing.T) {
+	setTestCacheConnections(t)
+	cacheMut.Lock()
+	previousTTL := cacheTTLOverride
+	ttl := int64(300)
+	cacheTTLOverride = &ttl
+	// the cache of the table was cleared a minute ago, which caps its ttl
+	cacheClearedAt[getCacheKeyForTable("prod", "cleared_table")] = time.Now().Add(-time.Minute)
+	cacheMut.Unlock()
+	t.Cleanup(func() {
+		cacheMut.Lock()
+		cacheTTLOverride = previousTTL
+		cacheMut.Unlock()
+	})
+
+	tests := []struct {
+		name     string
+		table    string
+		queryTTL *QueryCacheTTL
+		want     int64
+	}{
+		{"session ttl", "test_table", nil, 300},
+		{"query ttl", "test_table", &QueryCacheTTL{Seconds: 30}, 30},
+		{"query ttl of 0 fetches fresh data", "test_table", &QueryCacheTTL{Seconds: 0}, 0},
+		{"cleared table", "cleared_table", nil, 60},
+		{"query ttl of 0 overrides the ttl of a cleared table", "cleared_table", &QueryCacheTTL{Seconds: 0}, 0},
+		{"query ttl longer than the ttl of a cleared table", "cleared_table", &QueryCacheTTL{Seconds: 600}, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := &PluginCursor{table: &PluginTable{name: tt.table, connection: "all"}}
+			req := cursor.buildExecuteRequest("all", &QueryContext{CacheTTL: tt.queryTTL}, nil)
+			if req.CacheTtl != tt.want {
+				t.Errorf("cache ttl = %d, want %d", req.CacheTtl, tt.want)
+			}
+			// the aggregator executes the request against each of its children with the same ttl
+			for _, connection := range []string{"dev", "prod"} {
+				if got := req.ExecuteConnectionData[connection].GetCacheTtl(); got != tt.want {
+					t.Errorf("cache ttl of connection '%s' = %d, want %d", connection, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildQualMap(t *testing.T) {
+	id := &proto.ColumnDefinition{Name: "id", Type: proto.ColumnType_INT}
+	name := &proto.ColumnDefinition{Name: "name", Type: proto.ColumnType_STRING}
+	ip := &proto.ColumnDefinition{Name: "ip", Type: proto.ColumnType_IPADDR}
+	cidr := &proto.ColumnDefinition{Name: "cidr", Type: proto.ColumnType_CIDR}
+	qual := func(column *proto.ColumnDefinition, operator string, argvIndex int) *Qual {
+		return &Qual{FieldName: column.Name, Operator: operator, ColumnDefinition: column, ArgvIndex: argvIndex}
+	}
+	pluginQual := func(column string, operator string, value *proto.QualValue) *proto.Qual {
+		return &proto.Qual{FieldName: column, Operator: &proto.Qual_StringValue{StringValue: operator}, Value: value}
+	}
+	intValue := func(v int64) *proto.QualValue {
+		return &proto.QualValue{Value: &proto.QualValue_Int64Value{Int64Value: v}}
+	}
+	stringValue := func(v string) *proto.QualValue {
+		return &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: v}}
+	}
+
+	tests := []struct {
+		name    string
+		quals   []*Qual
+		values  []any
+		want    map[string][]*proto.Qual
+		wantErr string
+	}{
+		{
+			"quals on different columns",
+			[]*Qual{qual(id, "=", 1), qual(name, "=", 2)},
+			[]any{int64(1), "a"},
+			map[string][]*proto.Qual{
+				"id":   {pluginQual("id", "=", intValue(1))},
+				"name": {pluginQual("name", "=", stringValue("a"))},
+			},
+			"",
+		},
+		{
+			"both bounds of a range on a column",
+			[]*Qual{qual(id, ">=", 1), qual(id, "<=", 2)},
+			[]any{int64(1), int64(10)},
+			map[string][]*proto.Qual{
+				"id": {pluginQual("id", ">=", intValue(1)), pluginQual("id", "<=", intValue(10))},
+			},
+			"",
+		},
+		{
+			"a comparison with NULL is not passed to the plugin",
+			[]*Qual{qual(id, "=", 1), qual(name, "=", 2)},
+			[]any{nil, "a"},
+			map[string][]*proto.Qual{
+				"name": {pluginQual("name", "=", stringValue("a"))},
+			},
+			"",
+		},
+		{
+			"is null",
+			[]*Qual{qual(name, "is null", 1)},
+			[]any{nil},
+			map[string][]*proto.Qual{
+				"name": {pluginQual("name", "is null", &proto.QualValue{})},
+			},
+			"",
+		},
+		{
+			"valid cidr",
+			[]*Qual{qual(cidr, "=", 1)},
+			[]any{"10.0.0.0/8"},
+			map[string][]*proto.Qual{
+				"cidr": {pluginQual("cidr", "=", &proto.QualValue{Value: &proto.QualValue_InetValue{InetValue: &proto.Inet{Cidr: "10.0.0.0/8"}}})},
+			},
+			"",
+		},
+		{
+			"invalid ip address",
+			[]*Qual{qual(id, "=", 1), qual(ip, "=", 2)},
+			[]any{int64(1), "localhost"},
+			nil,
+			"invalid value for column 'ip'",
+		},
+		{
+			"invalid cidr",
+			[]*Qual{qual(cidr, "=", 1)},
+			[]any{"10.0.0.0"},
+			nil,
+			"invalid value for column 'cidr'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := &PluginCursor{}
+			got, err := cursor.buildQualMap(&QueryContext{Quals: tt.quals}, tt.values...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("buildQualMap() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildQualMap() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("buildQualMap() has quals on %d columns, want %d", len(got), len(tt.want))
+			}
+			for column, want := range tt.want {
+				if !goproto.Equal(got[column], &proto.Quals{Quals: want}) {
+					t.Errorf("quals of column '%s' = %v, want %v", column, got[column], want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetColumnValue(t *testing.T) {
+	column := func(columnType proto.ColumnType) *proto.ColumnDefinition {
+		return &proto.ColumnDefinition{Name: "c", Type: columnType}
+	}
+	created := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)
+
+	tests := []struct {
+		name    string
+		column  *proto.ColumnDefinition
+		value   *proto.Column
+		want    any
+		wantErr string
+	}{
+		{"missing value", column(proto.ColumnType_INT), nil, nil, ""},
+		{"null value", column(proto.ColumnType_STRING), &proto.Column{Value: &proto.Column_NullValue{}}, nil, ""},
+		{"unset value", column(proto.ColumnType_STRING), &proto.Column{}, nil, ""},
+		{"true", column(proto.ColumnType_BOOL), &proto.Column{Value: &proto.Column_BoolValue{BoolValue: true}}, int64(1), ""},
+		{"false", column(proto.ColumnType_BOOL), &proto.Column{Value: &proto.Column_BoolValue{BoolValue: false}}, int64(0), ""},
+		{"zero int", column(proto.ColumnType_INT), &proto.Column{Value: &proto.Column_IntValue{IntValue: 0}}, int64(0), ""},
+		{"double", column(proto.ColumnType_DOUBLE), &proto.Column{Value: &proto.Column_DoubleValue{DoubleValue: 1.5}}, 1.5, ""},
+		{"empty string", column(proto.ColumnType_STRING), &proto.Column{Value: &proto.Column_StringValue{}}, "", ""},
+		{"json", column(proto.ColumnType_JSON), &proto.Column{Value: &proto.Column_JsonValue{JsonValue: []byte(`{"a":1}`)}}, jsonValue(`{"a":1}`), ""},
+		{"timestamp", column(proto.ColumnType_TIMESTAMP), &proto.Column{Value: &proto.Column_TimestampValue{TimestampValue: timestamppb.New(created)}}, "2024-01-02 03:04:05.6", ""},
+		{"null timestamp", column(proto.ColumnType_TIMESTAMP), &proto.Column{Value: &proto.Column_TimestampValue{}}, nil, ""},
+		{"ip address", column(proto.ColumnType_IPADDR), &proto.Column{Value: &proto.Column_IpAddrValue{IpAddrValue: "10.0.0.1"}}, "10.0.0.1", ""},
+		{"inet", column(proto.ColumnType_INET), &proto.Column{Value: &proto.Column_CidrRangeValue{CidrRangeValue: "10.0.0.0/8"}}, "10.0.0.0/8", ""},
+		{"ltree", column(proto.ColumnType_LTREE), &proto.Column{Value: &proto.Column_LtreeValue{LtreeValue: "a.b"}}, "a.b", ""},
+		{"value of another type", column(proto.ColumnType_INT), &proto.Column{Value: &proto.Column_StringValue{StringValue: "1"}}, nil, "column 'c' of type INT holds a value of type *proto.Column_StringValue"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getColumnValue(tt.column, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("getColumnValue() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getColumnValue() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getColumnValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"go.riyazali.net/sqlite"
+)
+
+// the columns of the steampipe_explain table
+// the hidden sql column is the argument of the table valued function
+var explainTableColumns = SQLiteColumns{
+	{Name: "table_name", Type: "TEXT"},
+	{Name: "connection", Type: "TEXT"},
+	{Name: "strategy", Type: "TEXT"},
+	{Name: "columns", Type: "TEXT"},
+	{Name: "quals", Type: "TEXT"},
+	{Name: "dropped", Type: "TEXT"},
+	{Name: "sort_order", Type: "TEXT"},
+	{Name: "has_limit", Type: "INT"},
+	{Name: "cost", Type: "REAL"},
+	{Name: "rows", Type: "INT"},
+	{Name: "key_columns_satisfied", Type: "INT"},
+	{Name: "missing_quals", Type: "TEXT"},
+	{Name: "sql", Type: "TEXT", Hidden: true},
+}
+
+// the detail of the EXPLAIN QUERY PLAN row of a virtual table scan is
+// SCAN <table> VIRTUAL TABLE INDEX <idxNum>:<idxStr>
+// the idxStr of a plugin table is the serialized QueryContext chosen by BestIndex
+const explainVirtualTableMarker = " VIRTUAL TABLE INDEX "
+
+// ExplainModule implements the steampipe_explain table valued function
+// which describes how the plugin tables of a statement are queried, without running it:
+//
+//	select * from steampipe_explain('select * from aws_s3_bucket where name = ''x''')
+type ExplainModule struct {
+	*MetadataModule
+	api *sqlite.ExtensionApi
+}
+
+func NewExplainModule(api *sqlite.ExtensionApi) *ExplainModule {
+	return &ExplainModule{
+		MetadataModule: NewMetadataModule("steampipe_explain", explainTableColumns, nil),
+		api:            api,
+	}
+}
+
+func (m *ExplainModule) Connect(_ *sqlite.Conn, _ []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	log.Println("[TRACE] ExplainModule.Connect")
+	table := &ExplainTable{MetadataTable: &MetadataTable{module: m.MetadataModule}, api: m.api}
+	return table, declare(fmt.Sprintf("CREATE TABLE %s(%s)", m.name, m.columns.DeclarationString()))
+}
+
+// ExplainTable is the virtual table of the ExplainModule
+type ExplainTable struct {
+	*MetadataTable
+	api *sqlite.ExtensionApi
+}
+
+// BestIndex passes the sql argument to xFilter
+// SQLite must not check the constraint, since the sql column is never populated
+func (t *ExplainTable) BestIndex(info *sqlite.IndexInfoInput) (*sqlite.IndexInfoOutput, error) {
+	output, err := t.MetadataTable.BestIndex(info)
+	if err != nil {
+		return nil, err
+	}
+	sqlColumn := len(explainTableColumns) - 1
+	for idx, ic := range info.Constraints {
+		if ic.Usable && ic.ColumnIndex == sqlColumn && ic.Op == sqlite.INDEX_CONSTRAINT_EQ {
+			output.ConstraintUsage[idx] = &sqlite.ConstraintUsage{
+				ArgvIndex: 1,
+				Omit:      true,
+			}
+			output.EstimatedCost = 1
+			break
+		}
+	}
+	return output, nil
+}
+
+func (t *ExplainTable) Open() (sqlite.VirtualCursor, error) {
+	return &ExplainCursor{MetadataCursor: &MetadataCursor{table: t.MetadataTable}, api: t.api}, nil
+}
+
+// ExplainCursor builds a row for every plugin table scanned by the statement
+type ExplainCursor struct {
+	*MetadataCursor
+	api *sqlite.ExtensionApi
+}
+
+func (c *ExplainCursor) Filter(_ int, _ string, values ...sqlite.Value) error {
+	log.Println("[TRACE] ExplainCursor.Filter")
+
+	if len(values) == 0 || values[0].Type() != sqlite.SQLITE_TEXT {
+		return errors.New("steampipe_explain expects the SQL statement to explain, e.g. steampipe_explain('select ...')")
+	}
+	rows, err := explain(c.api.Connection(), values[0].Text())
+	if err != nil {
+		return err
+	}
+	c.rows = rows
+	c.currentRow = 0
+	return nil
+}
+
+// explain plans the statement with EXPLAIN QUERY PLAN, and returns the query context
+// of every plugin table in the plan - the statement itself is not run
+func explain(conn *sqlite.Conn, sql string) ([]MetadataRow, error) {
+	var rows []MetadataRow
+	err := conn.Exec("EXPLAIN QUERY PLAN "+sql, func(stmt *sqlite.Stmt) error {
+		row, err := getExplainDetailRow(stmt.GetText("detail"))
+		if err != nil || row == nil {
+			return err
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// getExplainDetailRow returns the row of the detail of an EXPLAIN QUERY PLAN row,
+// or nil if the detail is not the scan of a plugin table
+func getExplainDetailRow(detail string) (MetadataRow, error) {
+	_, index, found := strings.Cut(detail, explainVirtualTableMarker)
+	if !found {
+		return nil, nil
+	}
+	_, idxStr, _ := strings.Cut(index, ":")
+	qc := new(QueryContext)
+	// the tables of other modules (e.g. the introspection tables) do not use a query context
+	if err := json.Unmarshal([]byte(idxStr), qc); err != nil || qc.Table == "" {
+		return nil, nil
+	}
+	return getExplainRow(qc)
+}
+
+func getExplainRow(qc *QueryContext) (MetadataRow, error) {
+	quals := make([]map[string]string, 0, len(qc.Quals))
+	for _, q := range qc.Quals {
+		quals = append(quals, map[string]string{"column": q.FieldName, "operator": q.Operator})
+	}
+	dropped := make([]map[string]string, 0, len(qc.Dropped))
+	for _, d := range qc.Dropped {
+		dropped = append(dropped, map[string]string{"column": d.FieldName, "operator": d.Operator})
+	}
+	sortOrder := make([]map[string]string, 0, len(qc.SortOrder))
+	for _, s := range qc.SortOrder {
+		sortOrder = append(sortOrder, map[string]string{"column": s.GetColumn(), "order": s.GetOrder().String()})
+	}
+	jsonValues := make([]string, 0, 4)
+	for _, v := range []any{qc.Columns, quals, dropped, sortOrder} {
+		b, err := getJSONText(v)
+		if err != nil {
+			return nil, err
+		}
+		jsonValues = append(jsonValues, b)
+	}
+
+	var cost any
+	var rows any
+	if qc.Estimate != nil && qc.Strategy != QUERY_STRATEGY_NONE {
+		cost = qc.Estimate.Cost
+		rows = qc.Estimate.Rows
+	}
+
+	var missingQuals any
+	if c, ok := getConnection(qc.Connection); ok {
+		if tableSchema, ok := c.Schema.GetSchema()[qc.Table]; ok {
+			table := &PluginTable{name: qc.Table, connection: qc.Connection, tableSchema: tableSchema, getOnly: isGetOnlyTable(qc.Table)}
+			if err := table.getMissingKeyColumnsError(qc); err != nil {
+				missingQuals = err.Error()
+			}
+		}
+	}
+
+	return MetadataRow{
+		qc.Table,
+		qc.Connection,
+		string(qc.Strategy),
+		jsonValues[0],
+		jsonValues[1],
+		jsonValues[2],
+		jsonValues[3],
+		qc.Limit != nil,
+		cost,
+		rows,
+		qc.Strategy != QUERY_STRATEGY_NONE,
+		missingQuals,
+	}, nil
+}
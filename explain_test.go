@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"go.riyazali.net/sqlite"
+)
+
+func TestGetExplainDetailRow(t *testing.T) {
+	t.Cleanup(func() {
+		connectionsMut.Lock()
+		connections = make(map[string]*Connection)
+		connectionsMut.Unlock()
+	})
+	schema := &proto.Schema{Schema: map[string]*proto.TableSchema{
+		"test_instance": {
+			Columns: []*proto.ColumnDefinition{
+				{Name: "id", Type: proto.ColumnType_STRING},
+				{Name: "cores", Type: proto.ColumnType_INT},
+				{Name: "name", Type: proto.ColumnType_STRING},
+			},
+			GetCallKeyColumnList:  []*proto.KeyColumn{{Name: "id", Operators: []string{"="}, Require: "required"}},
+			ListCallKeyColumnList: []*proto.KeyColumn{{Name: "cores", Operators: []string{"=", ">"}, Require: "optional"}},
+		},
+		"test_zone": {
+			Columns:               []*proto.ColumnDefinition{{Name: "region", Type: proto.ColumnType_STRING}},
+			ListCallKeyColumnList: []*proto.KeyColumn{{Name: "region", Operators: []string{"="}, Require: "required"}},
+		},
+	}}
+	setConnection(&Connection{Name: "prod", Config: &proto.ConnectionConfig{Connection: "prod"}, Schema: schema})
+
+	// getDetail plans the table as SQLite does, and returns the detail of its EXPLAIN QUERY PLAN row
+	getDetail := func(t *testing.T, table string, constraints ...*sqlite.IndexConstraint) string {
+		t.Helper()
+		pluginTable := &PluginTable{name: table, connection: "prod", tableSchema: schema.Schema[table]}
+		colUsed := int64(1)
+		output, err := pluginTable.BestIndex(&sqlite.IndexInfoInput{Constraints: constraints, ColUsed: &colUsed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "SCAN prod_" + table + explainVirtualTableMarker + "1:" + output.IndexString
+	}
+
+	tests := []struct {
+		name   string
+		detail func(t *testing.T) string
+		// the strategy, quals, dropped, has_limit, key_columns_satisfied and missing_quals columns
+		want MetadataRow
+	}{
+		{
+			"list with a pushed qual and a dropped qual",
+			func(t *testing.T) string {
+				return getDetail(t, "test_instance",
+					&sqlite.IndexConstraint{ColumnIndex: 1, Op: sqlite.INDEX_CONSTRAINT_GT, Usable: true},
+					&sqlite.IndexConstraint{ColumnIndex: 2, Op: sqlite.INDEX_CONSTRAINT_GT, Usable: true})
+			},
+			MetadataRow{"list", `[{"column":"cores","operator":">"}]`, `[{"column":"name","operator":">"}]`, false, true, nil},
+		},
+		{
+			"get",
+			func(t *testing.T) string {
+				return getDetail(t, "test_instance", &sqlite.IndexConstraint{ColumnIndex: 0, Op: sqlite.INDEX_CONSTRAINT_EQ, Usable: true})
+			},
+			MetadataRow{"get", `[{"column":"id","operator":"="}]`, `[]`, false, true, nil},
+		},
+		{
+			"missing required key column",
+			func(t *testing.T) string { return getDetail(t, "test_zone") },
+			MetadataRow{"none", `[]`, `[]`, false, false, "missing required quals: column 'region'"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, err := getExplainDetailRow(tt.detail(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row == nil {
+				t.Fatal("getExplainDetailRow() returned no row")
+			}
+			got := MetadataRow{row[2], row[4], row[5], row[7], row[10], row[11]}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("getExplainDetailRow() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+
+	// the plan of a statement scans other tables too, which have no row
+	for _, detail := range []string{
+		"SCAN t",
+		"SCAN steampipe_tables VIRTUAL TABLE INDEX 0:",
+		"SCAN prod_test_instance VIRTUAL TABLE INDEX 1:{not json",
+	} {
+		t.Run(detail, func(t *testing.T) {
+			if row, err := getExplainDetailRow(detail); row != nil || err != nil {
+				t.Errorf("getExplainDetailRow(%q) = %v, %v, want no row", detail, row, err)
+			}
+		})
+	}
+}
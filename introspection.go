@@ -0,0 +1,150 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"go.riyazali.net/sqlite"
+	"golang.org/x/exp/maps"
+)
+
+// setupIntrospectionTables creates the read-only tables which expose the plugin schema
+// of every configured connection, and the state of the extension
+func setupIntrospectionTables(api *sqlite.ExtensionApi) error {
+	modules := []*MetadataModule{
+		NewMetadataModule("steampipe_tables", SQLiteColumns{
+			{Name: "connection", Type: "TEXT"},
+			{Name: "name", Type: "TEXT"},
+			{Name: "sqlite_name", Type: "TEXT"},
+			{Name: "description", Type: "TEXT"},
+		}, getIntrospectionTableRows),
+		NewMetadataModule("steampipe_columns", SQLiteColumns{
+			{Name: "connection", Type: "TEXT"},
+			{Name: "table_name", Type: "TEXT"},
+			{Name: "name", Type: "TEXT"},
+			{Name: "position", Type: "INT"},
+			{Name: "type", Type: "TEXT"},
+			{Name: "sqlite_type", Type: "TEXT"},
+			{Name: "sort_order", Type: "TEXT"},
+			{Name: "description", Type: "TEXT"},
+		}, getIntrospectionColumnRows),
+		NewMetadataModule("steampipe_key_columns", SQLiteColumns{
+			{Name: "connection", Type: "TEXT"},
+			{Name: "table_name", Type: "TEXT"},
+			{Name: "name", Type: "TEXT"},
+			{Name: "call", Type: "TEXT"},
+			{Name: "operators", Type: "TEXT"},
+			{Name: "require", Type: "TEXT"},
+			{Name: "cache_match", Type: "TEXT"},
+		}, getIntrospectionKeyColumnRows),
+		NewMetadataModule("steampipe_cache_stats", SQLiteColumns{
+			{Name: "connection", Type: "TEXT"},
+			{Name: "table_name", Type: "TEXT"},
+			{Name: "hits", Type: "INT"},
+			{Name: "misses", Type: "INT"},
+			{Name: "hit_ratio", Type: "REAL"},
+			// the plugin cache does not report these - they are estimated by the extension
+			{Name: "estimated_entries", Type: "INT"},
+			{Name: "estimated_bytes", Type: "INT"},
+			{Name: "estimated_evictions", Type: "INT"},
+		}, getCacheStatsRows),
+		NewMetadataModule("steampipe_query_log", SQLiteColumns{
+			{Name: "call_id", Type: "TEXT"},
+			{Name: "connection", Type: "TEXT"},
+			{Name: "table_name", Type: "TEXT"},
+			{Name: "columns", Type: "TEXT"},
+			{Name: "quals", Type: "TEXT"},
+			{Name: "limit_rows", Type: "INT"},
+			{Name: "start_time", Type: "TEXT"},
+			{Name: "duration_ms", Type: "REAL"},
+			{Name: "status", Type: "TEXT"},
+			{Name: "cache_hit", Type: "INT"},
+			{Name: "rows", Type: "INT"},
+			{Name: "error", Type: "TEXT"},
+		}, getQueryLogRows),
+	}
+
+	for _, m := range modules {
+		if err := api.CreateModule(m.name, m, sqlite.ReadOnly(true)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachTableSchema calls fn for every table of every configured connection, ordered by connection and table
+func forEachTableSchema(fn func(connection *Connection, tableName string, tableSchema *proto.TableSchema) error) error {
+	for _, c := range listConnections() {
+		tables := c.Schema.GetSchema()
+		tableNames := maps.Keys(tables)
+		slices.Sort(tableNames)
+		for _, tableName := range tableNames {
+			if err := fn(c, tableName, tables[tableName]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func getIntrospectionTableRows() ([]MetadataRow, error) {
+	var rows []MetadataRow
+	err := forEachTableSchema(func(c *Connection, tableName string, tableSchema *proto.TableSchema) error {
+		rows = append(rows, MetadataRow{c.Name, tableName, c.TableName(tableName), tableSchema.GetDescription()})
+		return nil
+	})
+	return rows, err
+}
+
+func getIntrospectionColumnRows() ([]MetadataRow, error) {
+	var rows []MetadataRow
+	err := forEachTableSchema(func(c *Connection, tableName string, tableSchema *proto.TableSchema) error {
+		for i, column := range tableSchema.GetColumns() {
+			rows = append(rows, MetadataRow{
+				c.Name,
+				tableName,
+				column.GetName(),
+				i,
+				strings.ToLower(column.GetType().String()),
+				getMappedType(column.GetType()),
+				strings.ToLower(column.GetSortOrder().String()),
+				column.GetDescription(),
+			})
+		}
+		return nil
+	})
+	return rows, err
+}
+
+func getIntrospectionKeyColumnRows() ([]MetadataRow, error) {
+	var rows []MetadataRow
+	err := forEachTableSchema(func(c *Connection, tableName string, tableSchema *proto.TableSchema) error {
+		calls := []struct {
+			call       string
+			keyColumns []*proto.KeyColumn
+		}{
+			{"get", tableSchema.GetGetCallKeyColumnList()},
+			{"list", tableSchema.GetListCallKeyColumnList()},
+		}
+		for _, call := range calls {
+			for _, keyColumn := range call.keyColumns {
+				operators, err := getJSONText(keyColumn.GetOperators())
+				if err != nil {
+					return err
+				}
+				rows = append(rows, MetadataRow{
+					c.Name,
+					tableName,
+					keyColumn.GetName(),
+					call.call,
+					operators,
+					keyColumn.GetRequire(),
+					keyColumn.GetCacheMatch(),
+				})
+			}
+		}
+		return nil
+	})
+	return rows, err
+}
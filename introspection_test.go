@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+)
+
+// setTestIntrospectionConnections sets the connections prod and test (the default connection of the test plugin)
+// for the duration of the test
+func setTestIntrospectionConnections(t *testing.T) {
+	t.Helper()
+	previousAlias := pluginAlias
+	t.Cleanup(func() {
+		pluginAlias = previousAlias
+		connectionsMut.Lock()
+		connections = make(map[string]*Connection)
+		connectionsMut.Unlock()
+	})
+	pluginAlias = "test"
+
+	schema := &proto.Schema{Schema: map[string]*proto.TableSchema{
+		"test_instance": {
+			Description: "Instances",
+			Columns: []*proto.ColumnDefinition{
+				{Name: "id", Type: proto.ColumnType_STRING, SortOrder: proto.SortOrder_All, Description: "The id"},
+				{Name: "cores", Type: proto.ColumnType_INT},
+			},
+			GetCallKeyColumnList:  []*proto.KeyColumn{{Name: "id", Operators: []string{"="}, Require: "required", CacheMatch: "subset"}},
+			ListCallKeyColumnList: []*proto.KeyColumn{{Name: "cores", Operators: []string{"=", ">"}, Require: "optional", CacheMatch: "exact"}},
+		},
+		"test_bucket": {
+			Columns: []*proto.ColumnDefinition{{Name: "name", Type: proto.ColumnType_STRING}},
+		},
+	}}
+	setConnection(&Connection{Name: "prod", Config: &proto.ConnectionConfig{Connection: "prod"}, Schema: schema})
+	setConnection(&Connection{Name: "test", Config: &proto.ConnectionConfig{Connection: "test"}, Schema: schema})
+}
+
+func TestGetIntrospectionRows(t *testing.T) {
+	setTestIntrospectionConnections(t)
+
+	tests := []struct {
+		name    string
+		getRows func() ([]MetadataRow, error)
+		want    []MetadataRow
+	}{
+		{
+			"tables",
+			getIntrospectionTableRows,
+			[]MetadataRow{
+				{"prod", "test_bucket", "prod_test_bucket", ""},
+				{"prod", "test_instance", "prod_test_instance", "Instances"},
+				{"test", "test_bucket", "test_bucket", ""},
+				{"test", "test_instance", "test_instance", "Instances"},
+			},
+		},
+		{
+			"columns",
+			getIntrospectionColumnRows,
+			[]MetadataRow{
+				{"prod", "test_bucket", "name", 0, "string", "TEXT", "none", ""},
+				{"prod", "test_instance", "id", 0, "string", "TEXT", "all", "The id"},
+				{"prod", "test_instance", "cores", 1, "int", "INT", "none", ""},
+				{"test", "test_bucket", "name", 0, "string", "TEXT", "none", ""},
+				{"test", "test_instance", "id", 0, "string", "TEXT", "all", "The id"},
+				{"test", "test_instance", "cores", 1, "int", "INT", "none", ""},
+			},
+		},
+		{
+			"key columns",
+			getIntrospectionKeyColumnRows,
+			[]MetadataRow{
+				{"prod", "test_instance", "id", "get", `["="]`, "required", "subset"},
+				{"prod", "test_instance", "cores", "list", `["=",">"]`, "optional", "exact"},
+				{"test", "test_instance", "id", "get", `["="]`, "required", "subset"},
+				{"test", "test_instance", "cores", "list", `["=",">"]`, "optional", "exact"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.getRows()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForEachTableSchema(t *testing.T) {
+	setTestIntrospectionConnections(t)
+	errStop := errors.New("stop")
+
+	tests := []struct {
+		name       string
+		stopAfter  int
+		wantErr    error
+		wantTables []string
+	}{
+		{"every table of every connection in order", -1, nil, []string{"prod_test_bucket", "prod_test_instance", "test_bucket", "test_instance"}},
+		{"an error stops the iteration", 2, errStop, []string{"prod_test_bucket", "prod_test_instance"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tables []string
+			err := forEachTableSchema(func(c *Connection, tableName string, _ *proto.TableSchema) error {
+				tables = append(tables, c.TableName(tableName))
+				if len(tables) == tt.stopAfter {
+					return errStop
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("forEachTableSchema() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(tables, tt.wantTables) {
+				t.Errorf("tables = %q, want %q", tables, tt.wantTables)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log"
+
+	"go.riyazali.net/sqlite"
+)
+
+// LastErrorFn implements a custom scalar sql function
+// that returns the detail of the last error raised by a plugin table as JSON
+type LastErrorFn struct{}
+
+func NewLastErrorFn() *LastErrorFn {
+	return &LastErrorFn{}
+}
+
+func (m *LastErrorFn) Args() int           { return 0 }
+func (m *LastErrorFn) Deterministic() bool { return false }
+func (m *LastErrorFn) Apply(ctx *sqlite.Context, _ ...sqlite.Value) {
+	log.Println("[TRACE] LastErrorFn.Apply start")
+	defer log.Println("[TRACE] LastErrorFn.Apply end")
+
+	lastError := getLastError()
+	if lastError == nil {
+		ctx.ResultNull()
+		return
+	}
+
+	setJSONResult(ctx, lastError)
+}
@@ -18,7 +18,7 @@ func setupLogger(plugin string) {
 		// make the name unique so that logs from this instance can be filtered
 		Name:       fmt.Sprintf("[%s]", plugin),
 		Level:      hcLevel,
-		Output:     os.Stderr,
+		Output:     &redactingWriter{out: os.Stderr},
 		TimeFn:     func() time.Time { return time.Now().UTC() },
 		TimeFormat: "2006-01-02 15:04:05.000 UTC",
 	}
@@ -5,24 +5,32 @@ import (
 	"log"
 	"math"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
 	"go.riyazali.net/sqlite"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type SQLiteColumn struct {
-	Name string
-	Type string
+	Name   string
+	Type   string
+	Hidden bool
 }
 type SQLiteColumns []SQLiteColumn
 
 func (s SQLiteColumns) DeclarationString() string {
 	var out []string
 	for _, c := range s {
-		out = append(out, fmt.Sprintf("\"%s\" %s", c.Name, c.Type))
+		declaration := fmt.Sprintf("\"%s\" %s", c.Name, c.Type)
+		if c.Hidden {
+			// hidden columns are not returned by SELECT *, but can be used in the WHERE clause
+			declaration += " HIDDEN"
+		}
+		out = append(out, declaration)
 	}
 
 	return strings.Join(out, ", ")
@@ -34,30 +42,119 @@ func getPluginOperator(op sqlite.ConstraintOp) *QualOperator {
 	defer log.Println("[TRACE] getPluginOperator end", op)
 
 	cost := &QualOperator{
-		Op:   "NOOP",
+		Op:   QUAL_OPERATOR_NOOP,
 		Cost: math.MaxFloat64,
 	}
 	switch op {
-	case sqlite.INDEX_CONSTRAINT_EQ:
-		cost.Op = "="
+	case sqlite.INDEX_CONSTRAINT_EQ, SQLITE_INDEX_CONSTRAINT_IS:
+		cost.Op = quals.QualOperatorEqual
 		cost.Cost = 1
 	case sqlite.INDEX_CONSTRAINT_GT:
-		cost.Op = ">"
+		cost.Op = quals.QualOperatorGreater
 		cost.Cost = 10
 	case sqlite.INDEX_CONSTRAINT_GE:
-		cost.Op = ">="
+		cost.Op = quals.QualOperatorGreaterOrEqual
 		cost.Cost = 10
 	case sqlite.INDEX_CONSTRAINT_LE:
-		cost.Op = "<="
+		cost.Op = quals.QualOperatorLessOrEqual
 		cost.Cost = 10
 	case sqlite.INDEX_CONSTRAINT_LT:
-		cost.Op = "<"
+		cost.Op = quals.QualOperatorLess
+		cost.Cost = 10
+	case SQLITE_INDEX_CONSTRAINT_LIKE:
+		// LIKE in SQLite is case insensitive
+		cost.Op = quals.QualOperatorILike
 		cost.Cost = 10
-		// we should extend this to include LIKE, GLOB, REGEXP, MATCH and others
+	case SQLITE_INDEX_CONSTRAINT_GLOB:
+		// GLOB is case sensitive - the pattern is translated to a LIKE pattern in getMappedQualValue
+		cost.Op = quals.QualOperatorLike
+		cost.Cost = 10
+	case SQLITE_INDEX_CONSTRAINT_NE:
+		cost.Op = quals.QualOperatorNotEqual
+		cost.Cost = 100
+	case SQLITE_INDEX_CONSTRAINT_ISNULL:
+		cost.Op = quals.QualOperatorIsNull
+		cost.Cost = 100
+	case SQLITE_INDEX_CONSTRAINT_ISNOTNULL:
+		cost.Op = quals.QualOperatorIsNotNull
+		cost.Cost = 100
+		// REGEXP and MATCH depend on user defined functions in SQLite
+		// so we cannot map them reliably to plugin operators
+		//
+		// IS NOT is not mapped to <>, since it matches NULL values as well - a plugin which
+		// applies the qual would drop rows which SQLite cannot get back
 	}
 	return cost
 }
 
+// getSQLiteOperatorName returns the SQL operator of a SQLite constraint
+func getSQLiteOperatorName(op sqlite.ConstraintOp) string {
+	switch op {
+	case sqlite.INDEX_CONSTRAINT_EQ:
+		return "="
+	case sqlite.INDEX_CONSTRAINT_GT:
+		return ">"
+	case sqlite.INDEX_CONSTRAINT_GE:
+		return ">="
+	case sqlite.INDEX_CONSTRAINT_LE:
+		return "<="
+	case sqlite.INDEX_CONSTRAINT_LT:
+		return "<"
+	case SQLITE_INDEX_CONSTRAINT_MATCH:
+		return "match"
+	case SQLITE_INDEX_CONSTRAINT_LIKE:
+		return "like"
+	case SQLITE_INDEX_CONSTRAINT_GLOB:
+		return "glob"
+	case SQLITE_INDEX_CONSTRAINT_REGEXP:
+		return "regexp"
+	case SQLITE_INDEX_CONSTRAINT_NE:
+		return "<>"
+	case SQLITE_INDEX_CONSTRAINT_ISNOT:
+		return "is not"
+	case SQLITE_INDEX_CONSTRAINT_ISNOTNULL:
+		return "is not null"
+	case SQLITE_INDEX_CONSTRAINT_ISNULL:
+		return "is null"
+	case SQLITE_INDEX_CONSTRAINT_IS:
+		return "is"
+	case SQLITE_INDEX_CONSTRAINT_LIMIT:
+		return "limit"
+	case SQLITE_INDEX_CONSTRAINT_OFFSET:
+		return "offset"
+	case SQLITE_INDEX_CONSTRAINT_FUNCTION:
+		return "function"
+	}
+	return strconv.Itoa(int(op))
+}
+
+// isNullCheckOperator returns whether the plugin operator is a unary NULL check
+func isNullCheckOperator(op string) bool {
+	return op == quals.QualOperatorIsNull || op == quals.QualOperatorIsNotNull
+}
+
+// getLikePatternFromGlob translates a GLOB pattern to the equivalent LIKE pattern
+// character classes cannot be expressed in a LIKE pattern, in which case ok is false
+func getLikePatternFromGlob(glob string) (pattern string, ok bool) {
+	var sb strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			sb.WriteRune('%')
+		case '?':
+			sb.WriteRune('_')
+		case '%', '_', '\\':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case '[':
+			return "", false
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String(), true
+}
+
 // getSQLiteColumnsFromTableSchema converts a proto.TableSchema to a SQLiteColumns
 // which can be used to create a SQLite table
 func getSQLiteColumnsFromTableSchema(ts *proto.TableSchema) SQLiteColumns {
@@ -67,6 +164,9 @@ func getSQLiteColumnsFromTableSchema(ts *proto.TableSchema) SQLiteColumns {
 	for _, col := range cols {
 		out = append(out, SQLiteColumn{Name: col.Name, Type: getMappedType(col.Type)})
 	}
+	// the hidden cache ttl column follows the columns of the plugin table
+	// it sets the cache ttl of a single query, e.g. WHERE _cache_ttl = 0 fetches fresh data
+	out = append(out, SQLiteColumn{Name: CACHE_TTL_COLUMN, Type: "INT", Hidden: true})
 	return out
 }
 
@@ -83,24 +183,71 @@ func getMappedType(in proto.ColumnType) string {
 	}
 }
 
-// getMappedQualValue converts a sqlite.Value to a proto.QualValue
-// based on the type of the column definition of the qual
-func getMappedQualValue(v sqlite.Value, qual *Qual) (*proto.QualValue, error) {
-	log.Println("[DEBUG] getMappedQualValue", v, qual)
-	defer log.Println("[DEBUG] end getMappedQualValue", v, qual)
+// getQualValue converts the value of a constraint which SQLite passes to xFilter to a Go value:
+// nil for NULL, an int64, a float64, or a string for TEXT and BLOB values
+func getQualValue(v sqlite.Value) any {
 	switch v.Type() {
+	case sqlite.SQLITE_NULL:
+		return nil
 	case sqlite.SQLITE_INTEGER:
-		return getMappedIntValue(v.Int64(), qual)
-	case sqlite.SQLITE_TEXT:
-		return getMappedStringValue(v.Text(), qual)
+		return v.Int64()
 	case sqlite.SQLITE_FLOAT:
-		return &proto.QualValue{Value: &proto.QualValue_DoubleValue{DoubleValue: v.Float()}}, nil
-	case sqlite.SQLITE_NULL:
+		return v.Float()
+	default:
+		return v.Text()
+	}
+}
+
+// getMappedQualValue converts the value of a constraint (see getQualValue) to a proto.QualValue
+// based on the type of the column definition of the qual
+//
+// a nil value (without an error) is returned if the qual cannot be passed to the plugin
+// this is safe, since SQLite always double checks the constraints on the returned rows
+func getMappedQualValue(v any, qual *Qual) (*proto.QualValue, error) {
+	log.Println("[DEBUG] getMappedQualValue", v, qual)
+	defer log.Println("[DEBUG] end getMappedQualValue", v, qual)
+
+	// IS NULL and IS NOT NULL do not have a right hand value
+	if isNullCheckOperator(qual.Operator) {
 		return &proto.QualValue{Value: nil}, nil
+	}
+	// comparisons with NULL (e.g. 'col IS ?' bound to NULL) cannot be expressed as plugin quals
+	if v == nil {
+		return nil, nil
+	}
+
+	switch qual.Operator {
+	case quals.QualOperatorLike, quals.QualOperatorILike:
+		return getMappedPatternValue(fmt.Sprint(v), qual)
+	}
+
+	switch v := v.(type) {
+	case int64:
+		return getMappedIntValue(v, qual)
+	case float64:
+		return &proto.QualValue{Value: &proto.QualValue_DoubleValue{DoubleValue: v}}, nil
 	default:
-		// default to a string
-		return &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: v.Text()}}, nil
+		return getMappedStringValue(fmt.Sprint(v), qual)
+	}
+}
+
+// getMappedPatternValue converts the pattern of a LIKE or GLOB constraint to a proto.QualValue
+func getMappedPatternValue(v string, q *Qual) (*proto.QualValue, error) {
+	log.Println("[DEBUG] getMappedPatternValue", v, q)
+	defer log.Println("[DEBUG] end getMappedPatternValue", v, q)
+
+	if q.Operator == quals.QualOperatorLike {
+		// the only case sensitive pattern comes from a GLOB constraint
+		pattern, ok := getLikePatternFromGlob(v)
+		if !ok {
+			return nil, nil
+		}
+		return &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: pattern}}, nil
 	}
+
+	// SQLite LIKE has no escape character by default, whereas plugin LIKE patterns treat a backslash as one
+	pattern := strings.ReplaceAll(v, "\\", "\\\\")
+	return &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: pattern}}, nil
 }
 
 // getMappedStringValue converts a string to a proto.QualValue
@@ -122,9 +269,8 @@ func getMappedStringValue(v string, q *Qual) (*proto.QualValue, error) {
 		}
 		return nil, fmt.Errorf("could not parse '%s' as IP ADDR", v)
 	case proto.ColumnType_CIDR:
-		_, _, err := net.ParseCIDR(v)
-		if err == nil {
-			return nil, err
+		if _, _, err := net.ParseCIDR(v); err != nil {
+			return nil, fmt.Errorf("could not parse '%s' as CIDR", v)
 		}
 		return &proto.QualValue{
 			Value: &proto.QualValue_InetValue{
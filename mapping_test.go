@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
+	"go.riyazali.net/sqlite"
+)
+
+func TestGetPluginOperator(t *testing.T) {
+	tests := []struct {
+		name string
+		op   sqlite.ConstraintOp
+		want string
+	}{
+		{"eq", sqlite.INDEX_CONSTRAINT_EQ, quals.QualOperatorEqual},
+		{"is", SQLITE_INDEX_CONSTRAINT_IS, quals.QualOperatorEqual},
+		{"gt", sqlite.INDEX_CONSTRAINT_GT, quals.QualOperatorGreater},
+		{"ge", sqlite.INDEX_CONSTRAINT_GE, quals.QualOperatorGreaterOrEqual},
+		{"le", sqlite.INDEX_CONSTRAINT_LE, quals.QualOperatorLessOrEqual},
+		{"lt", sqlite.INDEX_CONSTRAINT_LT, quals.QualOperatorLess},
+		{"like is case insensitive", SQLITE_INDEX_CONSTRAINT_LIKE, quals.QualOperatorILike},
+		{"glob is case sensitive", SQLITE_INDEX_CONSTRAINT_GLOB, quals.QualOperatorLike},
+		{"ne", SQLITE_INDEX_CONSTRAINT_NE, quals.QualOperatorNotEqual},
+		{"is null", SQLITE_INDEX_CONSTRAINT_ISNULL, quals.QualOperatorIsNull},
+		{"is not null", SQLITE_INDEX_CONSTRAINT_ISNOTNULL, quals.QualOperatorIsNotNull},
+		// IS NOT matches NULL values, which <> does not
+		{"is not", SQLITE_INDEX_CONSTRAINT_ISNOT, QUAL_OPERATOR_NOOP},
+		{"regexp", SQLITE_INDEX_CONSTRAINT_REGEXP, QUAL_OPERATOR_NOOP},
+		{"match", SQLITE_INDEX_CONSTRAINT_MATCH, QUAL_OPERATOR_NOOP},
+		{"limit", SQLITE_INDEX_CONSTRAINT_LIMIT, QUAL_OPERATOR_NOOP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getPluginOperator(tt.op).Op; got != tt.want {
+				t.Errorf("getPluginOperator(%d) = %q, want %q", tt.op, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLikePatternFromGlob(t *testing.T) {
+	tests := []struct {
+		glob   string
+		want   string
+		wantOk bool
+	}{
+		{"abc", "abc", true},
+		{"i-*", "i-%", true},
+		{"i-?23", "i-_23", true},
+		{"100%", "100\\%", true},
+		{"a_b*", "a\\_b%", true},
+		{"a\\b", "a\\\\b", true},
+		{"", "", true},
+		{"[abc]*", "", false},
+		{"x[0-9]", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			got, ok := getLikePatternFromGlob(tt.glob)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("getLikePatternFromGlob(%q) = %q, %v, want %q, %v", tt.glob, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
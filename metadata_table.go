@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"go.riyazali.net/sqlite"
+)
+
+// MetadataRow is a single row of a metadata table
+// the values must be in the same order as the columns of the table
+type MetadataRow []any
+
+// MetadataRowsFunc builds the rows of a metadata table - it is called every time the table is scanned
+type MetadataRowsFunc func() ([]MetadataRow, error)
+
+// MetadataModule implements a read-only virtual table whose rows are built in memory
+// from the state of the extension - e.g. the plugin schema of the configured connections
+type MetadataModule struct {
+	name    string
+	columns SQLiteColumns
+	rowsFn  MetadataRowsFunc
+}
+
+func NewMetadataModule(name string, columns SQLiteColumns, rowsFn MetadataRowsFunc) *MetadataModule {
+	return &MetadataModule{
+		name:    name,
+		columns: columns,
+		rowsFn:  rowsFn,
+	}
+}
+
+func (m *MetadataModule) Connect(_ *sqlite.Conn, _ []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	log.Println("[TRACE] MetadataModule.Connect", m.name)
+	return &MetadataTable{module: m}, declare(fmt.Sprintf("CREATE TABLE %s(%s)", m.name, m.columns.DeclarationString()))
+}
+
+// MetadataTable is the virtual table of a MetadataModule
+// it does not use any constraints - SQLite filters the (few) rows itself
+type MetadataTable struct {
+	module *MetadataModule
+}
+
+func (t *MetadataTable) BestIndex(info *sqlite.IndexInfoInput) (*sqlite.IndexInfoOutput, error) {
+	output := &sqlite.IndexInfoOutput{
+		EstimatedCost:   1000,
+		ConstraintUsage: make([]*sqlite.ConstraintUsage, len(info.Constraints)),
+	}
+	for idx := range info.Constraints {
+		output.ConstraintUsage[idx] = &sqlite.ConstraintUsage{
+			// return an argvIndex of -1 so that this does not get passed in to xFilter
+			ArgvIndex: -1,
+			Omit:      false,
+		}
+	}
+	return output, nil
+}
+
+func (t *MetadataTable) Open() (sqlite.VirtualCursor, error) {
+	return &MetadataCursor{table: t}, nil
+}
+
+func (t *MetadataTable) Disconnect() error { return nil }
+func (t *MetadataTable) Destroy() error    { return nil }
+
+// MetadataCursor iterates the rows of a MetadataTable
+type MetadataCursor struct {
+	table      *MetadataTable
+	rows       []MetadataRow
+	currentRow int
+}
+
+func (c *MetadataCursor) Filter(_ int, _ string, _ ...sqlite.Value) error {
+	log.Println("[TRACE] MetadataCursor.Filter", c.table.module.name)
+
+	rows, err := c.table.module.rowsFn()
+	if err != nil {
+		return err
+	}
+	c.rows = rows
+	c.currentRow = 0
+	return nil
+}
+
+func (c *MetadataCursor) Next() error {
+	c.currentRow++
+	return nil
+}
+
+func (c *MetadataCursor) Rowid() (int64, error) {
+	return int64(c.currentRow), nil
+}
+
+func (c *MetadataCursor) Column(context *sqlite.VirtualTableContext, columnIdx int) error {
+	row := c.rows[c.currentRow]
+	if columnIdx >= len(row) {
+		context.ResultNull()
+		return nil
+	}
+
+	switch v := row[columnIdx].(type) {
+	case nil:
+		context.ResultNull()
+	case string:
+		context.ResultText(v)
+	case bool:
+		if v {
+			context.ResultInt(1)
+		} else {
+			context.ResultInt(0)
+		}
+	case int:
+		context.ResultInt(v)
+	case int64:
+		context.ResultInt64(v)
+	case float64:
+		context.ResultFloat(v)
+	default:
+		context.ResultText(fmt.Sprintf("%v", v))
+	}
+	return nil
+}
+
+func (c *MetadataCursor) Eof() bool {
+	return c.currentRow >= len(c.rows)
+}
+
+func (c *MetadataCursor) Close() error {
+	c.rows = nil
+	return nil
+}
+
+// getJSONText returns the JSON text of a value of a metadata row
+// json.Marshal would escape the '<' and '>' of operators, so the encoder is used without HTML escaping
+func getJSONText(v any) (string, error) {
+	buffer := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buffer)
+	jsonEncoder.SetEscapeHTML(false)
+	if err := jsonEncoder.Encode(v); err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))), nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestGetJSONText(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		want    string
+		wantErr bool
+	}{
+		{"operators are not escaped", []string{"=", "<>", "<=", ">="}, `["=","<>","<=",">="]`, false},
+		{"empty list", []string{}, `[]`, false},
+		{"null", nil, `null`, false},
+		{"value which cannot be encoded", make(chan int), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getJSONText(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getJSONText() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getJSONText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,12 +15,14 @@ type Module struct {
 	table       sqlite.VirtualTable
 }
 
-func NewModule(tableName string, columns SQLiteColumns, tableSchema *proto.TableSchema) *Module {
+// NewModule creates the module for a plugin table of the given connection
+// the module is named after the SQLite table, which is prefixed for non-default connections
+func NewModule(connection string, tableName string, columns SQLiteColumns, tableSchema *proto.TableSchema) *Module {
 	return &Module{
-		tableName:   tableName,
+		tableName:   getTableNameForConnection(connection, tableName),
 		columns:     columns,
 		tableSchema: tableSchema,
-		table:       &PluginTable{name: tableName, tableSchema: tableSchema},
+		table:       &PluginTable{name: tableName, connection: connection, tableSchema: tableSchema, getOnly: isGetOnlyTable(tableName)},
 	}
 }
 
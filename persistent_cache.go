@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/turbot/go-kit/types"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	goproto "google.golang.org/protobuf/proto"
+)
+
+// the persistent cache stores complete query results in a directory, so that they survive
+// the end of the SQLite session. it is enabled by setting the path of the directory,
+// either with the STEAMPIPE_SQLITE_CACHE_PATH environment variable or with steampipe_cache_path()
+//
+// each result is stored in its own file, named after the SQLite table and a hash of
+// the connection config, the columns, the quals, the limit and the sort order of the query
+//
+// expired results are removed when they are read, and whenever a result is written the oldest results
+// are evicted once the directory holds more than the maximum size of the persistent cache
+var persistentCacheMut sync.RWMutex
+var persistentCachePathOverride *string
+
+// persistentCachePruneMut serializes the eviction of results from the cache directory
+var persistentCachePruneMut sync.Mutex
+
+const (
+	persistentCacheFileExtension = ".cache"
+	// the default maximum size of the persistent cache, which can be set with STEAMPIPE_SQLITE_CACHE_PATH_MAX_SIZE_MB
+	defaultPersistentCacheMaxSizeMb = 512
+)
+
+// persistentCachePath returns the directory of the persistent cache, or an empty string if it is disabled
+func persistentCachePath() string {
+	persistentCacheMut.RLock()
+	defer persistentCacheMut.RUnlock()
+	if persistentCachePathOverride != nil {
+		return *persistentCachePathOverride
+	}
+	return os.Getenv(EnvCachePath)
+}
+
+// persistentCacheMaxSize returns the maximum size (in bytes) of the persistent cache
+func persistentCacheMaxSize() int64 {
+	if envStr, ok := os.LookupEnv(EnvCachePathMaxSize); ok {
+		i64, err := types.ToInt64(envStr)
+		if err == nil && i64 > 0 {
+			return i64 * 1024 * 1024
+		}
+		log.Printf("[WARN] persistentCacheMaxSize: ignoring invalid %s value '%s' - expected a size in megabytes", EnvCachePathMaxSize, envStr)
+	}
+	return defaultPersistentCacheMaxSizeMb * 1024 * 1024
+}
+
+// setPersistentCachePath sets the directory of the persistent cache - an empty path disables it
+func setPersistentCachePath(path string) error {
+	if path != "" {
+		if err := os.MkdirAll(path, 0700); err != nil {
+			return fmt.Errorf("failed to create cache directory '%s': %w", path, err)
+		}
+	}
+	persistentCacheMut.Lock()
+	defer persistentCacheMut.Unlock()
+	persistentCachePathOverride = &path
+	return nil
+}
+
+// getPersistentCacheKey returns the file name of the persistent cache entry of a query
+func getPersistentCacheKey(c *Connection, table string, qc *proto.QueryContext) (string, error) {
+	queryBytes, err := goproto.MarshalOptions{Deterministic: true}.Marshal(qc)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(table))
+	hash.Write(queryBytes)
+	// the results of a connection depend on its config
+	// an aggregator connection depends on the config of all of its children
+	for _, connection := range c.ExecuteConnections() {
+		hash.Write([]byte(connection))
+		if child, ok := getConnection(connection); ok {
+			hash.Write([]byte(child.Config.GetConfig()))
+		}
+	}
+	return fmt.Sprintf("%s-%s%s", c.TableName(table), hex.EncodeToString(hash.Sum(nil)), persistentCacheFileExtension), nil
+}
+
+// readPersistentCache returns the cached rows for the key, if they are younger than the ttl (in seconds)
+func readPersistentCache(key string, ttl int64) ([]*proto.Row, bool) {
+	dir := persistentCachePath()
+	if dir == "" {
+		return nil, false
+	}
+	path := filepath.Join(dir, key)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	if age := time.Since(info.ModTime()); age > time.Duration(ttl)*time.Second {
+		log.Println("[TRACE] readPersistentCache: expired", key)
+		// the ttl of a single query may be shorter than the cache ttl - the result is only removed
+		// once no query can use it
+		if age > time.Duration(cacheTTL())*time.Second {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Println("[WARN] readPersistentCache: failed to remove", path, err)
+			}
+		}
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Println("[WARN] readPersistentCache: failed to read", path, err)
+		return nil, false
+	}
+	result := new(proto.QueryResult)
+	if err := goproto.Unmarshal(data, result); err != nil {
+		log.Println("[WARN] readPersistentCache: failed to parse", path, err)
+		return nil, false
+	}
+	return result.Rows, true
+}
+
+// writePersistentCache stores the rows for the key
+// the rows are written to a temporary file first, so that a reader never sees a partial result
+func writePersistentCache(key string, rows []*proto.Row) error {
+	dir := persistentCachePath()
+	if dir == "" {
+		return nil
+	}
+
+	data, err := goproto.Marshal(&proto.QueryResult{Rows: rows})
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, key+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(dir, key)); err != nil {
+		return err
+	}
+	return prunePersistentCache(dir, time.Duration(cacheTTL())*time.Second, persistentCacheMaxSize())
+}
+
+// prunePersistentCache removes the results in the directory which are older than the ttl,
+// then removes the oldest results until the results take up no more than maxBytes
+func prunePersistentCache(dir string, ttl time.Duration, maxBytes int64) error {
+	persistentCachePruneMut.Lock()
+	defer persistentCachePruneMut.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+persistentCacheFileExtension))
+	if err != nil {
+		return err
+	}
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cacheFile
+	var totalBytes int64
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			// removed by another session
+			continue
+		}
+		if time.Since(info.ModTime()) > ttl {
+			log.Println("[TRACE] prunePersistentCache: removing expired", path)
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		totalBytes += info.Size()
+	}
+
+	slices.SortFunc(files, func(a, b cacheFile) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	for _, f := range files {
+		if totalBytes <= maxBytes {
+			break
+		}
+		log.Println("[TRACE] prunePersistentCache: evicting", f.path)
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		totalBytes -= f.size
+	}
+	return nil
+}
+
+// clearPersistentCache removes the cached results of the given SQLite table, or of all tables if no table is given
+func clearPersistentCache(sqliteTableName string) error {
+	dir := persistentCachePath()
+	if dir == "" {
+		return nil
+	}
+
+	pattern := "*" + persistentCacheFileExtension
+	if sqliteTableName != "" {
+		pattern = sqliteTableName + "-" + pattern
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+)
+
+// writeCacheFile writes a cache file of the given size, last modified the given time ago
+func writeCacheFile(t *testing.T, dir string, name string, size int, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, make([]byte, size), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listCacheDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestPrunePersistentCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int64
+		want     []string
+	}{
+		{"removes expired results", 1000, []string{"a.cache", "b.cache", "c.cache", "other.txt"}},
+		{"evicts the oldest results above the size", 250, []string{"b.cache", "c.cache", "other.txt"}},
+		{"evicts until the size fits", 100, []string{"c.cache", "other.txt"}},
+		{"evicts everything", 0, []string{"other.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeCacheFile(t, dir, "expired.cache", 100, 2*time.Hour)
+			writeCacheFile(t, dir, "a.cache", 100, 30*time.Minute)
+			writeCacheFile(t, dir, "b.cache", 100, 20*time.Minute)
+			writeCacheFile(t, dir, "c.cache", 100, 10*time.Minute)
+			// only cache files are pruned
+			writeCacheFile(t, dir, "other.txt", 100, 2*time.Hour)
+
+			if err := prunePersistentCache(dir, time.Hour, tt.maxBytes); err != nil {
+				t.Fatal(err)
+			}
+			if got := listCacheDir(t, dir); !slices.Equal(got, tt.want) {
+				t.Errorf("prunePersistentCache left %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPersistentCacheExpired(t *testing.T) {
+	dir := t.TempDir()
+	if err := setPersistentCachePath(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		persistentCacheMut.Lock()
+		persistentCachePathOverride = nil
+		persistentCacheMut.Unlock()
+	})
+	// the default cache ttl is 10 hours
+	writeCacheFile(t, dir, "old.cache", 0, 11*time.Hour)
+	writeCacheFile(t, dir, "recent.cache", 0, time.Hour)
+
+	if _, ok := readPersistentCache("old.cache", 60); ok {
+		t.Error("expected old.cache to have expired")
+	}
+	// a query with a short ttl does not use the result, but other queries still can
+	if _, ok := readPersistentCache("recent.cache", 60); ok {
+		t.Error("expected recent.cache to have expired for a ttl of 60 seconds")
+	}
+	if got, want := listCacheDir(t, dir), []string{"recent.cache"}; !slices.Equal(got, want) {
+		t.Errorf("cache directory holds %v, want %v", got, want)
+	}
+	if _, ok := readPersistentCache("recent.cache", 7200); !ok {
+		t.Error("expected recent.cache to be read for a ttl of 2 hours")
+	}
+}
+
+func TestGetPersistentCacheKey(t *testing.T) {
+	prod := &Connection{Name: "prod", Config: &proto.ConnectionConfig{Connection: "prod", Config: `{"profile":"prod"}`}}
+	prodUpdated := &Connection{Name: "prod", Config: &proto.ConnectionConfig{Connection: "prod", Config: `{"profile":"other"}`}}
+	query := proto.NewQueryContext([]string{"name"}, map[string]*proto.Quals{
+		"name": {Quals: []*proto.Qual{{FieldName: "name", Operator: &proto.Qual_StringValue{StringValue: "="}, Value: &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: "x"}}}}},
+	}, -1, nil)
+	otherQuery := proto.NewQueryContext([]string{"name"}, nil, -1, nil)
+	limitQuery := proto.NewQueryContext([]string{"name"}, nil, 10, nil)
+
+	key := func(c *Connection, table string, qc *proto.QueryContext) string {
+		t.Helper()
+		setConnection(c)
+		t.Cleanup(func() { removeConnection(c.Name) })
+		k, err := getPersistentCacheKey(c, table, qc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	base := key(prod, "aws_s3_bucket", query)
+	if !strings.HasPrefix(base, "prod_aws_s3_bucket-") || !strings.HasSuffix(base, persistentCacheFileExtension) {
+		t.Errorf("key %q is not named after the SQLite table", base)
+	}
+	if again := key(prod, "aws_s3_bucket", query); again != base {
+		t.Errorf("key is not stable: %q != %q", again, base)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"other table", key(prod, "aws_ec2_instance", query)},
+		{"other quals", key(prod, "aws_s3_bucket", otherQuery)},
+		{"limit", key(prod, "aws_s3_bucket", limitQuery)},
+		{"other config", key(prodUpdated, "aws_s3_bucket", query)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.key == base {
+				t.Errorf("expected the key to change, got %q", tt.key)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type QueryErrorKind string
+
+const (
+	QUERY_ERROR_MISSING_QUALS QueryErrorKind = "missing_quals"
+	QUERY_ERROR_CONFIG        QueryErrorKind = "config"
+	QUERY_ERROR_RATE_LIMIT    QueryErrorKind = "rate_limit"
+	QUERY_ERROR_NOT_FOUND     QueryErrorKind = "not_found"
+	QUERY_ERROR_TIMEOUT       QueryErrorKind = "timeout"
+	QUERY_ERROR_UNKNOWN       QueryErrorKind = "error"
+)
+
+// the plugin names columns as column:'name' in key column errors
+// we name them as column 'name' in errors raised by the extension
+var queryErrorColumnRegex = regexp.MustCompile(`column:? ?'([^']+)'`)
+
+// grpc status errors are prefixed with the status code, which is just noise for the user
+var grpcErrorPrefixRegex = regexp.MustCompile(`^rpc error: code = \w+ desc = `)
+
+// the grpc status codes which classify the errors returned by plugins
+// these take precedence over the text of the error message
+var queryErrorCodes = map[codes.Code]QueryErrorKind{
+	codes.DeadlineExceeded:  QUERY_ERROR_TIMEOUT,
+	codes.ResourceExhausted: QUERY_ERROR_RATE_LIMIT,
+	codes.Unauthenticated:   QUERY_ERROR_CONFIG,
+	codes.PermissionDenied:  QUERY_ERROR_CONFIG,
+	codes.NotFound:          QUERY_ERROR_NOT_FOUND,
+}
+
+// the patterns used to classify the errors returned by plugins, if the error does not carry a status code
+// these are matched against the lower cased error message, on word boundaries - so that the digits
+// of an ARN or an account id are not mistaken for an HTTP status code
+var queryErrorPatterns = []struct {
+	kind     QueryErrorKind
+	patterns []*regexp.Regexp
+}{
+	{QUERY_ERROR_MISSING_QUALS, []*regexp.Regexp{
+		regexp.MustCompile(`\brequired quals?\b`),
+	}},
+	{QUERY_ERROR_TIMEOUT, []*regexp.Regexp{
+		regexp.MustCompile(`\bcontext deadline exceeded\b`),
+	}},
+	{QUERY_ERROR_RATE_LIMIT, []*regexp.Regexp{
+		regexp.MustCompile(`\brate ?limit(?:ed|ing|s)?\b`),
+		regexp.MustCompile(`\bthrottl(?:ed|ing|e)\w*\b`),
+		regexp.MustCompile(`\btoo many requests\b`),
+		regexp.MustCompile(`\b(?:status|status code|http|code)[\s:=]*429\b`),
+	}},
+	{QUERY_ERROR_CONFIG, []*regexp.Regexp{
+		regexp.MustCompile(`\bunauthori[sz]ed\b`),
+		regexp.MustCompile(`\bforbidden\b`),
+		regexp.MustCompile(`\baccess ?denied\w*\b`),
+		regexp.MustCompile(`\bpermission denied\b`),
+		regexp.MustCompile(`\bcredentials?\b`),
+		regexp.MustCompile(`\bauthenticat(?:e|ed|ion)\b`),
+		regexp.MustCompile(`\binvalid config\w*\b`),
+		regexp.MustCompile(`\bfailed to parse (?:the )?(?:connection )?config\w*\b`),
+		regexp.MustCompile(`\b(?:status|status code|http|code)[\s:=]*40[13]\b`),
+	}},
+	{QUERY_ERROR_NOT_FOUND, []*regexp.Regexp{
+		regexp.MustCompile(`\bnot found\b`),
+		regexp.MustCompile(`\b\w*notfound(?:exception|error)?\b`),
+		regexp.MustCompile(`\bnosuch\w+\b`),
+		regexp.MustCompile(`\bdoes not exist\b`),
+		regexp.MustCompile(`\b(?:status|status code|http|code)[\s:=]*404\b`),
+	}},
+}
+
+// QueryError is an error raised while querying a plugin table
+// it carries enough detail to tell the user which table, connection and column caused it
+type QueryError struct {
+	Kind       QueryErrorKind `json:"kind"`
+	Table      string         `json:"table"`
+	Connection string         `json:"connection"`
+	Columns    []string       `json:"columns,omitempty"`
+	Message    string         `json:"message"`
+	Time       time.Time      `json:"time"`
+}
+
+func NewQueryError(table *PluginTable, err error) *QueryError {
+	message := grpcErrorPrefixRegex.ReplaceAllString(strings.TrimSpace(err.Error()), "")
+	// plugin errors may echo the config of the connection
+	message = redactSecrets(message)
+
+	e := &QueryError{
+		Kind:       getQueryErrorKind(err, message),
+		Table:      table.name,
+		Connection: table.connection,
+		Message:    message,
+		Time:       time.Now(),
+	}
+	for _, match := range queryErrorColumnRegex.FindAllStringSubmatch(message, -1) {
+		e.Columns = append(e.Columns, match[1])
+	}
+	return e
+}
+
+func (e *QueryError) Error() string {
+	var columns string
+	if len(e.Columns) > 0 {
+		columns = fmt.Sprintf(" [column '%s']", strings.Join(e.Columns, "', '"))
+	}
+	return fmt.Sprintf("%s (connection '%s'): %s%s: %s", e.Table, e.Connection, e.Kind, columns, e.Message)
+}
+
+// getQueryErrorKind classifies the error returned by a plugin
+// the status code of a grpc error is used if it identifies the kind, otherwise the error message is matched
+func getQueryErrorKind(err error, message string) QueryErrorKind {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return QUERY_ERROR_TIMEOUT
+	}
+	if s, ok := status.FromError(err); ok {
+		if kind, ok := queryErrorCodes[s.Code()]; ok {
+			return kind
+		}
+	}
+
+	message = strings.ToLower(message)
+	for _, p := range queryErrorPatterns {
+		for _, pattern := range p.patterns {
+			if pattern.MatchString(message) {
+				return p.kind
+			}
+		}
+	}
+	return QUERY_ERROR_UNKNOWN
+}
+
+var lastErrorMut sync.RWMutex
+var lastError *QueryError
+
+func setLastError(e *QueryError) {
+	lastErrorMut.Lock()
+	defer lastErrorMut.Unlock()
+	lastError = e
+}
+
+func getLastError() *QueryError {
+	lastErrorMut.RLock()
+	defer lastErrorMut.RUnlock()
+	return lastError
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetQueryErrorKind(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want QueryErrorKind
+	}{
+		{"status permission denied", status.Error(codes.PermissionDenied, "nope"), QUERY_ERROR_CONFIG},
+		{"status unauthenticated", status.Error(codes.Unauthenticated, "nope"), QUERY_ERROR_CONFIG},
+		{"status resource exhausted", status.Error(codes.ResourceExhausted, "slow down"), QUERY_ERROR_RATE_LIMIT},
+		{"status not found", status.Error(codes.NotFound, "gone"), QUERY_ERROR_NOT_FOUND},
+		{"status code takes precedence", status.Error(codes.NotFound, "access denied"), QUERY_ERROR_NOT_FOUND},
+		{"context deadline", fmt.Errorf("execute: %w", context.DeadlineExceeded), QUERY_ERROR_TIMEOUT},
+		{"missing quals", errors.New("missing required quals: column 'id'"), QUERY_ERROR_MISSING_QUALS},
+		{"aws access denied", errors.New("operation error S3: GetBucket, AccessDeniedException: denied"), QUERY_ERROR_CONFIG},
+		{"aws throttling", errors.New("ThrottlingException: Rate exceeded"), QUERY_ERROR_RATE_LIMIT},
+		{"http 429", errors.New("request failed with status code 429"), QUERY_ERROR_RATE_LIMIT},
+		{"http 403", errors.New("http: 403"), QUERY_ERROR_CONFIG},
+		{"aws not found", errors.New("ResourceNotFoundException: no instance"), QUERY_ERROR_NOT_FOUND},
+		{"aws no such bucket", errors.New("NoSuchBucket: the bucket does not exist"), QUERY_ERROR_NOT_FOUND},
+		{"digits in an arn", errors.New("arn:aws:iam::123401403404:role/x failed"), QUERY_ERROR_UNKNOWN},
+		{"digits in an account id", errors.New("account 429401 is suspended"), QUERY_ERROR_UNKNOWN},
+		{"author is not auth", errors.New("invalid author field"), QUERY_ERROR_UNKNOWN},
+		{"no such host is a network error", errors.New("dial tcp: lookup x: no such host"), QUERY_ERROR_UNKNOWN},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getQueryErrorKind(tt.err, tt.err.Error()); got != tt.want {
+				t.Errorf("getQueryErrorKind(%q) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
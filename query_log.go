@@ -0,0 +1,151 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+)
+
+// the number of plugin executions kept in the query log - older executions are overwritten
+const queryLogSize = 1000
+
+type QueryLogStatus string
+
+const (
+	// the plugin is still streaming rows
+	QUERY_LOG_STATUS_RUNNING QueryLogStatus = "running"
+	// all rows have been streamed
+	QUERY_LOG_STATUS_COMPLETE QueryLogStatus = "complete"
+	// SQLite stopped reading the rows before the end - e.g. the LIMIT is satisfied
+	QUERY_LOG_STATUS_CLOSED QueryLogStatus = "closed"
+	QUERY_LOG_STATUS_ERROR  QueryLogStatus = "error"
+)
+
+// QueryLogEntry records an ExecuteRequest issued by a cursor, and its outcome
+type QueryLogEntry struct {
+	CallId     string
+	Connection string
+	Table      string
+	Columns    []string
+	Quals      []grpc.SerializableQual
+	Limit      *int64
+	StartTime  time.Time
+	Status     QueryLogStatus
+	// whether the rows were read from the cache - nil until the first row is received
+	CacheHit *bool
+	Rows     int64
+	Duration time.Duration
+	Error    string
+}
+
+// the query log is a ring buffer of the most recent executions
+var queryLogMut sync.Mutex
+var queryLog = make([]*QueryLogEntry, 0, queryLogSize)
+var queryLogNext int
+
+// startQueryLogEntry records the start of a query of the table
+// the entry is started before the query is validated, and the request is set once it is built
+func startQueryLogEntry(connection string, table string) *QueryLogEntry {
+	e := &QueryLogEntry{
+		Connection: connection,
+		Table:      table,
+		StartTime:  time.Now(),
+		Status:     QUERY_LOG_STATUS_RUNNING,
+	}
+
+	queryLogMut.Lock()
+	defer queryLogMut.Unlock()
+	if len(queryLog) < queryLogSize {
+		queryLog = append(queryLog, e)
+	} else {
+		queryLog[queryLogNext] = e
+	}
+	queryLogNext = (queryLogNext + 1) % queryLogSize
+	return e
+}
+
+// setQueryLogRequest records the request which the query is executed with
+func setQueryLogRequest(e *QueryLogEntry, req *proto.ExecuteRequest) {
+	quals := grpc.QualMapToSerializableSlice(req.QueryContext.GetQuals())
+	// the quals are held in a map, so order them to make the log readable
+	slices.SortStableFunc(quals, func(a, b grpc.SerializableQual) int {
+		return strings.Compare(a.Column, b.Column)
+	})
+
+	queryLogMut.Lock()
+	defer queryLogMut.Unlock()
+	e.CallId = req.CallId
+	e.Columns = req.QueryContext.GetColumns()
+	e.Quals = quals
+	if limit := req.QueryContext.GetLimit(); limit != nil {
+		e.Limit = &limit.Value
+	}
+}
+
+// finishQueryLogEntry records the outcome of the execution
+func finishQueryLogEntry(e *QueryLogEntry, status QueryLogStatus, rows int64, cacheHit *bool, err error) {
+	queryLogMut.Lock()
+	defer queryLogMut.Unlock()
+	e.Status = status
+	e.Rows = rows
+	e.CacheHit = cacheHit
+	e.Duration = time.Since(e.StartTime)
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+// getQueryLogRows returns the rows of the steampipe_query_log table, oldest first
+func getQueryLogRows() ([]MetadataRow, error) {
+	queryLogMut.Lock()
+	defer queryLogMut.Unlock()
+
+	res := make([]MetadataRow, 0, len(queryLog))
+	for i := range queryLog {
+		// the oldest entry is the next to be overwritten (or the first, until the buffer is full)
+		e := queryLog[(queryLogNext+i)%len(queryLog)]
+
+		columns, err := getJSONText(e.Columns)
+		if err != nil {
+			return nil, err
+		}
+		quals, err := getJSONText(e.Quals)
+		if err != nil {
+			return nil, err
+		}
+		duration := e.Duration
+		if e.Status == QUERY_LOG_STATUS_RUNNING {
+			duration = time.Since(e.StartTime)
+		}
+		var limit, cacheHit, errorMessage any
+		if e.Limit != nil {
+			limit = *e.Limit
+		}
+		if e.CacheHit != nil {
+			cacheHit = *e.CacheHit
+		}
+		if e.Error != "" {
+			errorMessage = e.Error
+		}
+
+		res = append(res, MetadataRow{
+			e.CallId,
+			e.Connection,
+			e.Table,
+			columns,
+			quals,
+			limit,
+			e.StartTime.UTC().Format(SQLITE_TIMESTAMP_FORMAT),
+			float64(duration.Microseconds()) / 1000,
+			string(e.Status),
+			cacheHit,
+			e.Rows,
+			errorMessage,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"go.riyazali.net/sqlite"
+)
+
+func resetQueryLog(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		queryLogMut.Lock()
+		queryLog = make([]*QueryLogEntry, 0, queryLogSize)
+		queryLogNext = 0
+		queryLogMut.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestQueryLogRingBuffer(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   int
+		wantRows  int
+		wantFirst string
+		wantLast  string
+	}{
+		{"empty", 0, 0, "", ""},
+		{"partly full", 3, 3, "table_0", "table_2"},
+		{"full", queryLogSize, queryLogSize, "table_0", fmt.Sprintf("table_%d", queryLogSize-1)},
+		{"overwritten", queryLogSize + 5, queryLogSize, "table_5", fmt.Sprintf("table_%d", queryLogSize+4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetQueryLog(t)
+			for i := 0; i < tt.entries; i++ {
+				e := startQueryLogEntry("prod", fmt.Sprintf("table_%d", i))
+				finishQueryLogEntry(e, QUERY_LOG_STATUS_COMPLETE, 1, nil, nil)
+			}
+			rows, err := getQueryLogRows()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Fatalf("got %d rows, want %d", len(rows), tt.wantRows)
+			}
+			if tt.wantRows == 0 {
+				return
+			}
+			// the rows are ordered oldest first
+			if got := rows[0][2]; got != tt.wantFirst {
+				t.Errorf("first row table = %v, want %s", got, tt.wantFirst)
+			}
+			if got := rows[len(rows)-1][2]; got != tt.wantLast {
+				t.Errorf("last row table = %v, want %s", got, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestQueryLogEntry(t *testing.T) {
+	t.Run("executed", func(t *testing.T) {
+		resetQueryLog(t)
+		e := startQueryLogEntry("prod", "test_table")
+		setQueryLogRequest(e, &proto.ExecuteRequest{
+			CallId:       "call",
+			QueryContext: proto.NewQueryContext([]string{"id"}, nil, 10, nil),
+		})
+		hit := true
+		finishQueryLogEntry(e, QUERY_LOG_STATUS_COMPLETE, 4, &hit, nil)
+
+		rows, err := getQueryLogRows()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := MetadataRow{"call", "prod", "test_table", `["id"]`, "null", int64(10)}
+		for i, v := range want {
+			if rows[0][i] != v {
+				t.Errorf("column %d = %v, want %v", i, rows[0][i], v)
+			}
+		}
+		if status, cacheHit, rowCount, errorMessage := rows[0][8], rows[0][9], rows[0][10], rows[0][11]; status != "complete" || cacheHit != true || rowCount != int64(4) || errorMessage != nil {
+			t.Errorf("unexpected outcome: status %v, cache hit %v, rows %v, error %v", status, cacheHit, rowCount, errorMessage)
+		}
+	})
+
+	// a query which fails validation is logged before its request is built
+	t.Run("failed validation", func(t *testing.T) {
+		resetQueryLog(t)
+		e := startQueryLogEntry("prod", "test_table")
+		finishQueryLogEntry(e, QUERY_LOG_STATUS_ERROR, 0, nil, errors.New("missing required quals: column 'id'"))
+
+		rows, err := getQueryLogRows()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("got %d rows, want 1", len(rows))
+		}
+		if status, errorMessage := rows[0][8], rows[0][11]; status != "error" || errorMessage != "missing required quals: column 'id'" {
+			t.Errorf("unexpected outcome: status %v, error %v", status, errorMessage)
+		}
+		if limit := rows[0][5]; limit != nil {
+			t.Errorf("limit = %v, want nil", limit)
+		}
+	})
+}
+
+func TestQueryLogQuals(t *testing.T) {
+	resetQueryLog(t)
+	e := startQueryLogEntry("prod", "test_table")
+	quals := map[string]*proto.Quals{
+		"cores": {Quals: []*proto.Qual{{
+			FieldName: "cores",
+			Operator:  &proto.Qual_StringValue{StringValue: ">"},
+			Value:     &proto.QualValue{Value: &proto.QualValue_Int64Value{Int64Value: 2}},
+		}}},
+	}
+	setQueryLogRequest(e, &proto.ExecuteRequest{QueryContext: proto.NewQueryContext([]string{"id"}, quals, -1, nil)})
+
+	rows, err := getQueryLogRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rows[0][4].(string); !strings.Contains(got, `"operator":">"`) {
+		t.Errorf("quals = %s, want the operator unescaped", got)
+	}
+}
+
+// testKeyColumnPlugin is a plugin with a table whose list call requires a key column
+func testKeyColumnPlugin(ctx context.Context) *plugin.Plugin {
+	p := testPlugin(ctx)
+	table := newTestTable("test_zone")
+	table.List.KeyColumns = plugin.SingleColumn("id")
+	p.TableMap = map[string]*plugin.Table{"test_zone": table}
+	return p
+}
+
+// a query which does not provide the required key columns of the table is not executed, but is logged with the error
+func TestQueryLogMissingKeyColumns(t *testing.T) {
+	setTestPluginServer(t, testKeyColumnPlugin)
+	resetQueryLog(t)
+	if _, err := NewConfigureFn(newTestSchemaApi()).setConnectionConfig("prod", ""); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := getConnection("prod")
+	table := &PluginTable{name: "test_zone", connection: "prod", tableSchema: c.Schema.GetSchema()["test_zone"]}
+
+	colUsed := int64(1)
+	_, queryErr := runTestQuery(t, table, &sqlite.IndexInfoInput{ColUsed: &colUsed})
+	if queryErr == nil || !strings.Contains(queryErr.Error(), "missing required quals") {
+		t.Fatalf("the query error = %v, want the missing key columns", queryErr)
+	}
+
+	rows, err := getQueryLogRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d query log rows, want 1", len(rows))
+	}
+	if connection, tableName, status, rowCount := rows[0][1], rows[0][2], rows[0][8], rows[0][10]; connection != "prod" || tableName != "test_zone" || status != "error" || rowCount != int64(0) {
+		t.Errorf("unexpected entry: connection %v, table %v, status %v, rows %v", connection, tableName, status, rowCount)
+	}
+	if errorMessage := rows[0][11]; errorMessage != queryErr.Error() {
+		t.Errorf("error = %v, want %q", errorMessage, queryErr.Error())
+	}
+}
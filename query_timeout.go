@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/turbot/go-kit/types"
+)
+
+// queryTimeoutOverride holds the timeout (in seconds) set with steampipe_set_query_timeout()
+// if it has not been set, the timeout is read from the environment
+var queryTimeoutMut sync.RWMutex
+var queryTimeoutOverride *int64
+
+// queryTimeout returns how long a plugin table query may run before it is cancelled
+// a zero value means that queries never time out
+func queryTimeout() time.Duration {
+	log.Println("[DEBUG] queryTimeout")
+	defer log.Println("[DEBUG] end queryTimeout")
+	queryTimeoutMut.RLock()
+	defer queryTimeoutMut.RUnlock()
+	if queryTimeoutOverride != nil {
+		return time.Duration(*queryTimeoutOverride) * time.Second
+	}
+	if envStr, ok := os.LookupEnv(EnvQueryTimeout); ok {
+		i64, err := types.ToInt64(envStr)
+		if err != nil || i64 < 0 {
+			log.Printf("[WARN] queryTimeout: ignoring invalid %s value '%s' - expected a number of seconds", EnvQueryTimeout, envStr)
+			return 0
+		}
+		return time.Duration(i64) * time.Second
+	}
+	return 0
+}
+
+func setQueryTimeout(seconds int64) {
+	queryTimeoutMut.Lock()
+	defer queryTimeoutMut.Unlock()
+	queryTimeoutOverride = &seconds
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"go.riyazali.net/sqlite"
+)
+
+// QueryTimeoutFn implements a custom scalar sql function
+// that sets the timeout (in seconds) of plugin table queries
+// a value of 0 disables the timeout
+type QueryTimeoutFn struct{}
+
+func NewQueryTimeoutFn() *QueryTimeoutFn {
+	return &QueryTimeoutFn{}
+}
+
+func (m *QueryTimeoutFn) Args() int           { return 1 }
+func (m *QueryTimeoutFn) Deterministic() bool { return false }
+func (m *QueryTimeoutFn) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	log.Println("[TRACE] QueryTimeoutFn.Apply start")
+	defer log.Println("[TRACE] QueryTimeoutFn.Apply end")
+
+	if values[0].Type() != sqlite.SQLITE_INTEGER || values[0].Int64() < 0 {
+		ctx.ResultError(errors.New("expected a non negative INTEGER number of seconds"))
+		return
+	}
+
+	setQueryTimeout(values[0].Int64())
+	ctx.ResultInt64(int64(queryTimeout().Seconds()))
+}
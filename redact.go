@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"regexp"
+)
+
+// the value which replaces secrets in logs and in the output of the extension
+const redactedValue = "<redacted>"
+
+// sensitiveKeyPattern matches the names of config keys which hold secrets - e.g. secret_key, api_token, password
+// the plugin SDK has no way to mark a config field as sensitive, so secrets are recognised by the name of their key:
+// a key is sensitive if one of its words (separated by _ . or -) ends with a sensitive word, or is auth
+// so that keys such as author, oauth_scopes or authority_url are not masked
+const sensitiveKeyPattern = `(?:[a-z0-9]+[_.-])*` +
+	`(?:[a-z0-9]*(?:password|passwd|secret|token|credentials?|api_?key|access_?key|private_?key)|auth)` +
+	`(?:[_.-][a-z0-9]+)*`
+
+// sensitiveValueRegex matches a sensitive key followed by its value, as written in HCL (key = "value")
+// JSON ("key": "value") or a log line (key: value)
+// the key must not follow other characters of a key name, so that only whole key names are matched
+var sensitiveValueRegex = regexp.MustCompile(`(?i)(^|[^\w.-])("?` + sensitiveKeyPattern + `"?\s*[:=]\s*)("(?:[^"\\]|\\.)*"|'[^']*'|[^\s,;}\]]+)`)
+
+// privateKeyRegex matches PEM encoded private keys, which may be embedded in a config
+var privateKeyRegex = regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+
+// redactSecrets masks the values of sensitive keys and any private keys in the given text
+func redactSecrets(s string) string {
+	s = privateKeyRegex.ReplaceAllString(s, redactedValue)
+	return sensitiveValueRegex.ReplaceAllString(s, `${1}${2}"`+redactedValue+`"`)
+}
+
+// redactingWriter masks secrets in everything which is written to the underlying writer
+// it is used for the log output, so that debug logs do not leak credentials
+type redactingWriter struct {
+	out io.Writer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := w.out.Write([]byte(redactSecrets(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
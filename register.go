@@ -1,69 +1,178 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"os"
+	"slices"
 	"strings"
 
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"go.riyazali.net/sqlite"
 )
 
-var currentSchema *proto.Schema
 var schemaType = SCHEMA_MODE_STATIC
 
-func register() {
-	pluginServer.SetCacheOptions(&proto.SetCacheOptionsRequest{
-		Enabled:   true,
-		Ttl:       300,
-		MaxSizeMb: 32,
-	})
+// pluginInstance is the plugin served by pluginServer
+// the plugin server does not expose the plugin it serves, so it is captured by registerPlugin when the server
+// creates it - its definition (e.g. its connection config schema and its tables) is read from here
+var pluginInstance *plugin.Plugin
 
+// registerPlugin wraps the function which creates the plugin, so that the served plugin is captured
+func registerPlugin(pluginFunc plugin.PluginFunc) plugin.PluginFunc {
+	return func(ctx context.Context) *plugin.Plugin {
+		pluginInstance = pluginFunc(ctx)
+		return pluginInstance
+	}
+}
+
+func register() {
 	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
-		configureFn := NewConfigureFn(api)
+		if err := applyCacheOptions(nil); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		schemaApi := NewSchemaApi(api)
+
+		configureFn := NewConfigureFn(schemaApi)
 		fnName := fmt.Sprintf("steampipe_configure_%s", pluginAlias)
 		fnName = strings.ToLower(fnName)
 		if err := api.CreateFunction(fnName, configureFn); err != nil {
 			return sqlite.SQLITE_ERROR, err
 		}
 
+		aggregatorFn := NewAggregatorFn(schemaApi)
+		aggregatorFnName := fmt.Sprintf("steampipe_configure_%s_aggregator", pluginAlias)
+		aggregatorFnName = strings.ToLower(aggregatorFnName)
+		if err := api.CreateFunction(aggregatorFnName, aggregatorFn); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		configureFileFnName := fmt.Sprintf("steampipe_configure_%s_file", pluginAlias)
+		configureFileFnName = strings.ToLower(configureFileFnName)
+		if err := api.CreateFunction(configureFileFnName, NewConfigureFileFn(schemaApi)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		validateConfigFnName := fmt.Sprintf("steampipe_validate_config_%s", pluginAlias)
+		validateConfigFnName = strings.ToLower(validateConfigFnName)
+		if err := api.CreateFunction(validateConfigFnName, NewValidateConfigFn()); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		if err := api.CreateFunction("steampipe_last_error", NewLastErrorFn()); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		if err := api.CreateFunction("steampipe_set_query_timeout", NewQueryTimeoutFn()); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		if err := setupCacheFunctions(api); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		if err := setupIntrospectionTables(api); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		if err := api.CreateModule("steampipe_connections", NewConnectionsModule(schemaApi)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		if err := api.CreateModule("steampipe_explain", NewExplainModule(api), sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		// the connections can be configured at startup from a config file
+		fileConnections, err := loadStartupConfigFile()
+		if err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
 		if SCHEMA_MODE_STATIC.Equals(pluginServer.GetSchemaMode()) {
 			// if the target plugin has a static schema, then the list of tables and columns
-			// is also static. let's just set it up with a blank config and setup the tables
-			if err := setInitialConfig(); err != nil {
+			// is also static. let's just set it up with the config of the default connection
+			// (which is blank if the config file does not define it) and setup the tables
+			var config string
+			fileConnections = slices.DeleteFunc(fileConnections, func(fc *FileConnection) bool {
+				if fc.Name == pluginAlias && !fc.IsAggregator() {
+					config = fc.Config
+					return true
+				}
+				return false
+			})
+			c, err := setInitialConfig(config)
+			if err != nil {
 				return sqlite.SQLITE_ERROR, err
 			}
-			schema, err := getSchema()
+			schema, err := getSchema(pluginAlias)
 			if err != nil {
 				return sqlite.SQLITE_ERROR, err
 			}
-			if err := setupTables(schema, api); err != nil {
+			if err := setupTables(pluginAlias, schema, schemaApi); err != nil {
 				return sqlite.SQLITE_ERROR, err
 			}
-			currentSchema = schema
+			setConnection(&Connection{Name: pluginAlias, Config: c, Schema: schema})
+		}
+
+		results, err := applyConfigFile(fileConnections, schemaApi)
+		if err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		for _, res := range results {
+			for _, warning := range res.Warnings {
+				log.Println("[WARN] register: config file:", warning)
+			}
 		}
 
 		return sqlite.SQLITE_OK, nil
 	})
 }
 
-func setInitialConfig() error {
-	pluginName := fmt.Sprintf("steampipe-plugin-%s", pluginAlias)
+// setupCacheFunctions creates the functions which manage the query cache at runtime
+func setupCacheFunctions(api *sqlite.ExtensionApi) error {
+	fns := map[string]sqlite.Function{
+		"steampipe_cache_clear":        NewCacheClearFn(),
+		"steampipe_cache_set_ttl":      NewCacheSetTtlFn(),
+		"steampipe_cache_enable":       NewCacheEnableFn(),
+		"steampipe_cache_set_max_size": NewCacheSetMaxSizeFn(),
+		"steampipe_cache_path":         NewCachePathFn(),
+	}
+	for name, fn := range fns {
+		if err := api.CreateFunction(name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	c := &proto.ConnectionConfig{
-		Connection:      pluginAlias,
-		Plugin:          pluginName,
-		PluginShortName: pluginAlias,
-		PluginInstance:  pluginName,
-		// set a blank config, so that we can fetch the schema from the plugin
-		Config: "",
+// loadStartupConfigFile loads the connections from the config file set in the environment (if any)
+func loadStartupConfigFile() ([]*FileConnection, error) {
+	path, ok := os.LookupEnv(EnvConfigFile)
+	if !ok || path == "" {
+		return nil, nil
 	}
+	return loadConfigFile(path)
+}
+
+// setInitialConfig sets up the default connection of the plugin
+// the config may be blank, which is enough to fetch the schema from the plugin
+func setInitialConfig(config string) (*proto.ConnectionConfig, error) {
+	c := newConnectionConfig(pluginAlias, config)
 
 	cs := []*proto.ConnectionConfig{c}
+	// a max cache size of -1 keeps the plugin from replacing its query cache with a default one,
+	// the cache is recreated with the cache options once the connection has been set
 	req := &proto.SetAllConnectionConfigsRequest{
 		Configs:        cs,
-		MaxCacheSizeMb: 32,
+		MaxCacheSizeMb: -1,
 	}
 
-	_, err := pluginServer.SetAllConnectionConfigs(req)
-	return err
+	if _, err := pluginServer.SetAllConnectionConfigs(req); err != nil {
+		return c, err
+	}
+	return c, applyCacheOptions(nil)
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"github.com/turbot/steampipe-plugin-sdk/v5/query_cache"
+	goproto "google.golang.org/protobuf/proto"
+)
+
+// testPluginConfig is the connection config of the test plugins
+type testPluginConfig struct {
+	Tables   []string `hcl:"tables,optional"`
+	Password *string  `hcl:"password"`
+}
+
+func newTestTable(name string) *plugin.Table {
+	list := func(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (any, error) {
+		d.StreamListItem(ctx, map[string]any{"id": "1"})
+		return nil, nil
+	}
+	return &plugin.Table{
+		Name: name,
+		List: &plugin.ListConfig{Hydrate: list},
+		Columns: []*plugin.Column{
+			{Name: "id", Type: proto.ColumnType_STRING, Transform: transform.FromField("id")},
+		},
+	}
+}
+
+// testPlugin is a plugin with a static schema of a single table
+func testPlugin(context.Context) *plugin.Plugin {
+	return &plugin.Plugin{
+		Name:                   "test",
+		ConnectionConfigSchema: &plugin.ConnectionConfigSchema{NewInstance: func() any { return &testPluginConfig{} }},
+		TableMap:               map[string]*plugin.Table{"test_table": newTestTable("test_table")},
+	}
+}
+
+// testDynamicPlugin is a plugin with a dynamic schema, whose tables are listed in the config of the connection
+func testDynamicPlugin(context.Context) *plugin.Plugin {
+	return &plugin.Plugin{
+		Name:                   "test",
+		SchemaMode:             plugin.SchemaModeDynamic,
+		ConnectionConfigSchema: &plugin.ConnectionConfigSchema{NewInstance: func() any { return &testPluginConfig{} }},
+		TableMapFunc: func(_ context.Context, d *plugin.TableMapData) (map[string]*plugin.Table, error) {
+			tables := make(map[string]*plugin.Table)
+			if config, ok := d.Connection.Config.(testPluginConfig); ok {
+				for _, name := range config.Tables {
+					tables[name] = newTestTable(name)
+				}
+			}
+			return tables, nil
+		},
+	}
+}
+
+// setTestPluginServer serves a test plugin in process for the duration of the test
+// the connections and cache options set by the test are reset when it ends
+func setTestPluginServer(t *testing.T, pluginFunc plugin.PluginFunc) {
+	t.Helper()
+	previousServer, previousInstance, previousAlias := pluginServer, pluginInstance, pluginAlias
+	cacheMut.Lock()
+	previousOptions := goproto.Clone(cacheOptions).(*proto.SetCacheOptionsRequest)
+	previousEnabled, previousTTL := cacheEnabledOverride, cacheTTLOverride
+	cacheMut.Unlock()
+	t.Cleanup(func() {
+		pluginServer, pluginInstance, pluginAlias = previousServer, previousInstance, previousAlias
+		cacheMut.Lock()
+		cacheOptions = previousOptions
+		cacheEnabledOverride, cacheTTLOverride = previousEnabled, previousTTL
+		cacheMut.Unlock()
+		connectionsMut.Lock()
+		connections = make(map[string]*Connection)
+		connectionsMut.Unlock()
+	})
+
+	pluginAlias = "test"
+	pluginServer = plugin.Server(&plugin.ServeOpts{PluginFunc: registerPlugin(pluginFunc)})
+	if err := applyCacheOptions(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getPluginQueryCache returns the query cache of the served plugin, which the plugin does not expose
+func getPluginQueryCache(t *testing.T) *query_cache.QueryCache {
+	t.Helper()
+	field := reflect.ValueOf(pluginInstance).Elem().FieldByName("queryCache")
+	if !field.IsValid() {
+		t.Fatal("the plugin has no query cache field")
+	}
+	return (*query_cache.QueryCache)(unsafe.Pointer(field.Pointer()))
+}
+
+// the plugin replaces its query cache with a default one when all of its connections are set,
+// unless it is told not to - the cache options set at runtime must survive configuring a connection
+func TestSetInitialConfigKeepsCacheOptions(t *testing.T) {
+	setTestPluginServer(t, testPlugin)
+	if err := setCacheEnabled(false); err != nil {
+		t.Fatal(err)
+	}
+	if getPluginQueryCache(t).Enabled {
+		t.Fatal("the query cache is enabled after disabling it")
+	}
+
+	if _, err := setInitialConfig(""); err != nil {
+		t.Fatal(err)
+	}
+
+	queryCache := getPluginQueryCache(t)
+	if queryCache.Enabled {
+		t.Error("configuring the connection enabled the query cache")
+	}
+	if _, ok := queryCache.PluginSchemaMap[pluginAlias]; !ok {
+		t.Errorf("the query cache does not have the schema of connection '%s'", pluginAlias)
+	}
+	cacheMut.RLock()
+	defer cacheMut.RUnlock()
+	if cacheOptions.Enabled {
+		t.Error("configuring the connection changed the cache options")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"go.riyazali.net/sqlite"
+)
+
+// SchemaApi is the part of the SQLite extension api with which the tables of the connections are changed
+type SchemaApi interface {
+	// CreateModule creates the module of a virtual table
+	CreateModule(name string, module sqlite.Module, opts ...func(*sqlite.ModuleOptions)) error
+	// DropTable drops a virtual table
+	DropTable(name string) error
+	// InTransaction returns whether the database connection is inside a transaction
+	InTransaction() bool
+}
+
+// extensionSchemaApi implements the SchemaApi on the database connection of the extension
+type extensionSchemaApi struct {
+	*sqlite.ExtensionApi
+}
+
+func NewSchemaApi(api *sqlite.ExtensionApi) SchemaApi {
+	return &extensionSchemaApi{ExtensionApi: api}
+}
+
+func (a *extensionSchemaApi) DropTable(name string) error {
+	return a.Connection().Exec(fmt.Sprintf("DROP TABLE %s", name), nil)
+}
+
+func (a *extensionSchemaApi) InTransaction() bool {
+	return !a.Connection().GetAutocommit()
+}
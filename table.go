@@ -4,14 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"math"
-	"slices"
 	"strconv"
 	"sync/atomic"
 
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
-	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/sperr"
 	"go.riyazali.net/sqlite"
 	"golang.org/x/exp/maps"
@@ -19,15 +18,28 @@ import (
 
 /*
 QueryContext contains important query properties:
+  - The table and connection which are queried.
   - The columns requested.
   - The constraints specified.
   - The query qualifiers (where clauses).
   - The limit (number of rows to return).
+  - The sort order (if the plugin can return the rows in the order requested).
+  - The cache ttl (if the query sets the hidden _cache_ttl column).
+  - The strategy - whether the quals satisfy the get or the list call of the table.
+  - The estimated cost and rows of the plan, and the constraints which are not pushed down to the plugin.
+    These are not used by the cursor - they describe the plan to steampipe_explain.
 */
 type QueryContext struct {
-	Columns []string    `json:"columns"`
-	Quals   []*Qual     `json:"quals"`
-	Limit   *QueryLimit `json:"limit"`
+	Table      string              `json:"table"`
+	Connection string              `json:"connection"`
+	Columns    []string            `json:"columns"`
+	Quals      []*Qual             `json:"quals"`
+	Limit      *QueryLimit         `json:"limit"`
+	SortOrder  []*proto.SortColumn `json:"sort_order"`
+	CacheTTL   *QueryCacheTTL      `json:"cache_ttl"`
+	Strategy   QueryStrategy       `json:"strategy"`
+	Estimate   *CostEstimate       `json:"estimate"`
+	Dropped    []*DroppedQual      `json:"dropped,omitempty"`
 }
 
 type QueryLimit struct {
@@ -35,12 +47,25 @@ type QueryLimit struct {
 	ArgvIdx int   `json:"idx"` // the index in the values that Cursor.Filter receives
 }
 
+type QueryCacheTTL struct {
+	Seconds int64 `json:"-"`   // the cache ttl of the query - populated during xFilter
+	ArgvIdx int   `json:"idx"` // the index in the values that Cursor.Filter receives
+}
+
 type Qual struct {
 	ArgvIndex        int                     `json:"argv_index"`
 	FieldName        string                  `json:"field_name"`
 	Operator         string                  `json:"operator"`
 	ColumnDefinition *proto.ColumnDefinition `json:"column_definition"`
+	Cost             float64                 `json:"-"` // the cost of the operator - only used while planning
 }
+
+// DroppedQual is a constraint which cannot be passed to the plugin - SQLite evaluates it on the rows returned
+type DroppedQual struct {
+	FieldName string `json:"field_name,omitempty"`
+	Operator  string `json:"operator"`
+}
+
 type QualOperator struct {
 	Op   string  `json:"op"`
 	Cost float64 `json:"cost"`
@@ -48,8 +73,11 @@ type QualOperator struct {
 
 type PluginTable struct {
 	name        string
+	connection  string
 	tableSchema *proto.TableSchema
-	planNumber  int64
+	// whether the table defines a get call but no list call
+	getOnly    bool
+	planNumber int64
 }
 
 func (p *PluginTable) getLimit(info *sqlite.IndexInfoInput) (limit *QueryLimit) {
@@ -76,7 +104,9 @@ func (p *PluginTable) BestIndex(info *sqlite.IndexInfoInput) (output *sqlite.Ind
 	defer log.Println("[DEBUG] table.BestIndex end", p.name)
 
 	qc := &QueryContext{
-		Columns: p.getColumnsFromIndexInfo(info),
+		Table:      p.name,
+		Connection: p.connection,
+		Columns:    p.getColumnsFromIndexInfo(info),
 	}
 
 	defer func() {
@@ -84,6 +114,9 @@ func (p *PluginTable) BestIndex(info *sqlite.IndexInfoInput) (output *sqlite.Ind
 			log.Println("[ERROR] table.BestIndex recover: ", r)
 			err = sperr.ToError(r)
 		}
+		if output == nil {
+			return
+		}
 		log.Println("[TRACE] table.BestIndex idxnum: ", output.IndexNumber)
 		log.Println("[TRACE] table.BestIndex idxStr: ", output.IndexString)
 		log.Println("[TRACE] table.BestIndex output EstimatedCost: ", output.EstimatedCost)
@@ -119,8 +152,47 @@ func (p *PluginTable) BestIndex(info *sqlite.IndexInfoInput) (output *sqlite.Ind
 			continue
 		}
 
+		// the hidden cache ttl column is not a plugin column - its value sets the cache ttl of the query
+		// SQLite must not check the constraint, since the column holds the cache ttl in effect
+		// any other operator than = would silently leave the ttl unset, so the query is refused
+		if p.isCacheTTLColumn(ic.ColumnIndex) {
+			if ic.Op != sqlite.INDEX_CONSTRAINT_EQ {
+				log.Println("[TRACE] table.BestIndex cache ttl operator not supported", ic.Op)
+				return nil, fmt.Errorf("the '%s' column only supports the = operator, got '%s'", CACHE_TTL_COLUMN, getSQLiteOperatorName(ic.Op))
+			}
+			nextArgvIndex := int(currentArgvIndex.Add(1))
+			output.ConstraintUsage[idx] = &sqlite.ConstraintUsage{
+				ArgvIndex: nextArgvIndex,
+				Omit:      true,
+			}
+			qc.CacheTTL = &QueryCacheTTL{
+				ArgvIdx: nextArgvIndex,
+			}
+			continue
+		}
+
 		log.Println("[TRACE] table.BestIndex column >>>: ", p.tableSchema.Columns[ic.ColumnIndex])
 
+		// if the operator cannot be mapped to a plugin operator, or the column is not a key column
+		// which supports the operator, then it is not passed to xFilter
+		// SQLite will evaluate the constraint on the rows which are returned
+		qualOperator := getPluginOperator(ic.Op)
+		isLimit := ic.Op == sqlite.ConstraintOp(SQLITE_INDEX_CONSTRAINT_LIMIT)
+		if !isLimit && (qualOperator.Op == QUAL_OPERATOR_NOOP || !p.isKeyColumnOperator(p.tableSchema.Columns[ic.ColumnIndex].GetName(), qualOperator.Op)) {
+			log.Println("[TRACE] table.BestIndex constraint operator not supported", ic.Op)
+			output.ConstraintUsage[idx] = &sqlite.ConstraintUsage{
+				ArgvIndex: -1,
+				Omit:      false,
+			}
+			dropped := &DroppedQual{Operator: getSQLiteOperatorName(ic.Op)}
+			// an OFFSET is not a constraint on a column
+			if ic.Op != sqlite.ConstraintOp(SQLITE_INDEX_CONSTRAINT_OFFSET) {
+				dropped.FieldName = p.tableSchema.Columns[ic.ColumnIndex].GetName()
+			}
+			qc.Dropped = append(qc.Dropped, dropped)
+			continue
+		}
+
 		// default to using this constraint
 		nextArgvIndex := int(currentArgvIndex.Add(1))
 		output.ConstraintUsage[idx] = &sqlite.ConstraintUsage{
@@ -130,37 +202,42 @@ func (p *PluginTable) BestIndex(info *sqlite.IndexInfoInput) (output *sqlite.Ind
 
 		// if this is a limit constraint, then we need to handle it differently
 		// since it is not a constraint on a column
-		if ic.Op == sqlite.ConstraintOp(SQLITE_INDEX_CONSTRAINT_LIMIT) {
+		if isLimit {
 			qc.Limit = &QueryLimit{
 				ArgvIdx: nextArgvIndex,
 			}
 			continue
 		}
 
-		cost := p.getConstraintCost(ic)
-		if cost < output.EstimatedCost {
-			output.EstimatedCost = cost
-		}
-		qualOperator := getPluginOperator(ic.Op)
 		qc.Quals = append(qc.Quals, &Qual{
 			ArgvIndex:        nextArgvIndex,
 			FieldName:        p.tableSchema.Columns[ic.ColumnIndex].GetName(),
 			Operator:         qualOperator.Op,
 			ColumnDefinition: p.tableSchema.Columns[ic.ColumnIndex],
+			Cost:             qualOperator.Cost,
 		})
 	}
 
-	// we cannot do this and short circuit at the top of the function
-	// since we need to set the output.ConstraintUsage for all constraints
-	// even if they are not usable
-	if !p.allRequiredKeyColsInConstraints(info) {
-		// all key columns are not provided
-		// this is going to be a very high cost plan
-		// we do this instead of a SQLITE_CONSTRAINT error
-		// so that the query reaches the plugin which can provide
-		// a much richer error message around required
-		// key columns not being provided
-		output.EstimatedCost = math.MaxFloat64
+	// if the plugin can return the rows in the requested order, let it do the sorting
+	if sortOrder, ok := p.getSortOrder(info); ok {
+		qc.SortOrder = sortOrder
+		output.OrderByConsumed = true
+	}
+
+	// choose between the get and list call of the table, and estimate the cost of the API calls
+	// and the number of rows the plugin returns
+	// a get call returns at most one row, which lets SQLite plan lookups into this table in a join
+	//
+	// if the quals satisfy neither call, this is going to be a very high cost plan
+	// we do this instead of a SQLITE_CONSTRAINT error so that SQLite can still choose a plan,
+	// and the cursor raises an error which names the key columns which are not provided
+	qc.Strategy = p.getQueryStrategy(qc)
+	estimate := p.estimateCost(qc)
+	qc.Estimate = estimate
+	output.EstimatedCost = estimate.Cost
+	output.EstimatedRows = estimate.Rows
+	if estimate.Unique {
+		output.IdxFlags = SQLITE_INDEX_SCAN_UNIQUE
 	}
 
 	// serialize the QueryContext to JSON
@@ -179,76 +256,59 @@ func (p *PluginTable) BestIndex(info *sqlite.IndexInfoInput) (output *sqlite.Ind
 	return output, nil
 }
 
-func (p *PluginTable) allRequiredKeyColsInConstraints(info *sqlite.IndexInfoInput) bool {
-	log.Println("[DEBUG] table.verifyAllKeyColumnsInConstraints start")
-	defer log.Println("[DEBUG] table.verifyAllKeyColumnsInConstraints end")
+// isKeyColumnOperator returns whether the column is a key column of the get or list call, which supports the operator
+// the plugin only filters the rows on its key columns
+func (p *PluginTable) isKeyColumnOperator(column string, operator string) bool {
+	q := &Qual{FieldName: column, Operator: operator}
+	return isKeyColumnQual(p.tableSchema.GetGetCallKeyColumnList(), q) || isKeyColumnQual(p.tableSchema.GetListCallKeyColumnList(), q)
+}
 
-	// make a slice of all constraints (by name)
-	constraintColumns := make([]string, 0, len(info.Constraints))
-	for _, ic := range info.Constraints {
-		if ic.ColumnIndex == -1 {
-			// ROWID (-1 in ColumnIndex) cannot be used, since plugin tables do not have a parallel
-			continue
-		}
-		column := p.tableSchema.Columns[ic.ColumnIndex]
-		constraintColumns = append(constraintColumns, column.GetName())
-	}
+// getSortOrder converts the ORDER BY of the query to the sort order for the plugin
+// this is only possible if every column in the ORDER BY supports sorting in the requested direction
+func (p *PluginTable) getSortOrder(info *sqlite.IndexInfoInput) (sortOrder []*proto.SortColumn, ok bool) {
+	log.Println("[DEBUG] table.getSortOrder start")
+	defer log.Println("[DEBUG] table.getSortOrder end")
 
-	// get a slice of all key columns
-	keyColumns := make([]string, 0, len(p.tableSchema.GetAllKeyColumns()))
-	for _, keyColumn := range p.tableSchema.GetAllKeyColumns() {
-		if keyColumn.GetRequire() == plugin.Required {
-			// not concerned about optional columns
-			keyColumns = append(keyColumns, keyColumn.GetName())
-		}
+	if len(info.OrderBy) == 0 {
+		return nil, false
 	}
 
-	// check if all key columns are in the constraints
-	for _, keyColumn := range keyColumns {
-		if !slices.Contains(constraintColumns, keyColumn) {
-			return false
-		}
+	// rows of an aggregator are merged from several connections, so their order cannot be guaranteed
+	if c, ok := getConnection(p.connection); ok && c.IsAggregator() {
+		return nil, false
 	}
 
-	return true
-}
-
-func (p *PluginTable) getConstraintCost(ic *sqlite.IndexConstraint) (cost float64) {
-	log.Println("[DEBUG] table.getConstraintCost start")
-	defer log.Println("[DEBUG] table.getConstraintCost end")
-
-	schemaColumn := p.tableSchema.Columns[ic.ColumnIndex]
-	sqliteOp := ic.Op
-
-	log.Println("[DEBUG] >>> column: ", schemaColumn.GetName())
-	log.Println("[DEBUG] >>> sqliteOp: ", sqliteOp)
-
-	// is this a usable key column?
-	for _, keyColumn := range p.tableSchema.GetAllKeyColumns() {
-		if keyColumn.GetName() != schemaColumn.GetName() {
-			// not me
-			continue
+	for _, ob := range info.OrderBy {
+		if ob.ColumnIndex == -1 || p.isCacheTTLColumn(ob.ColumnIndex) {
+			// ROWID (-1 in ColumnIndex) and the cache ttl column cannot be sorted by the plugin
+			return nil, false
 		}
+		column := p.tableSchema.Columns[ob.ColumnIndex]
 
-		// does this key column support this operator?
-		for _, operator := range keyColumn.Operators {
-			log.Println("[DEBUG] >>> operator: ", operator, sqliteOp)
-			if qualOp := getPluginOperator(sqliteOp); qualOp.Op == operator {
-				return qualOp.Cost
-			}
+		order := proto.SortOrder_Asc
+		if ob.Desc {
+			order = proto.SortOrder_Desc
 		}
+		if column.GetSortOrder() != proto.SortOrder_All && column.GetSortOrder() != order {
+			log.Println("[TRACE] table.getSortOrder column does not support sort order", column.GetName(), order)
+			return nil, false
+		}
+		sortOrder = append(sortOrder, &proto.SortColumn{Column: column.GetName(), Order: order})
 	}
+	return sortOrder, true
+}
 
-	// this can be used, but with a high cost
-	return math.MaxFloat64
+// isCacheTTLColumn returns whether the column index is the hidden cache ttl column
+// which is declared after the columns of the plugin table
+func (p *PluginTable) isCacheTTLColumn(columnIdx int) bool {
+	return columnIdx == len(p.tableSchema.GetColumns())
 }
 
 func (p *PluginTable) Open() (sqlite.VirtualCursor, error) {
 	log.Println("[DEBUG] table.Open")
 	defer log.Println("[DEBUG] end table.Open")
 
-	cursor := NewPluginCursor(context.Background(), p)
-	return cursor, nil
+	return NewPluginCursor(context.Background(), p)
 }
 
 func (p *PluginTable) Disconnect() error {
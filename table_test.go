@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"go.riyazali.net/sqlite"
+	goproto "google.golang.org/protobuf/proto"
+)
+
+func TestIsKeyColumnOperator(t *testing.T) {
+	table := &PluginTable{
+		name: "test_table",
+		tableSchema: &proto.TableSchema{
+			GetCallKeyColumnList: []*proto.KeyColumn{
+				{Name: "id", Operators: []string{"="}, Require: "required"},
+			},
+			ListCallKeyColumnList: []*proto.KeyColumn{
+				{Name: "name", Operators: []string{"=", "<>", "~~*"}, Require: "optional"},
+			},
+		},
+	}
+	tests := []struct {
+		column   string
+		operator string
+		want     bool
+	}{
+		{"id", "=", true},
+		{"id", "<>", false},
+		{"name", "<>", true},
+		{"name", "~~*", true},
+		{"name", ">", false},
+		{"description", "=", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column+" "+tt.operator, func(t *testing.T) {
+			if got := table.isKeyColumnOperator(tt.column, tt.operator); got != tt.want {
+				t.Errorf("isKeyColumnOperator(%q, %q) = %v, want %v", tt.column, tt.operator, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBestIndexCacheTTL(t *testing.T) {
+	table := &PluginTable{
+		name: "test_table",
+		tableSchema: &proto.TableSchema{
+			Columns: []*proto.ColumnDefinition{
+				{Name: "id", Type: proto.ColumnType_STRING},
+				{Name: "name", Type: proto.ColumnType_STRING},
+			},
+			ListCallKeyColumnList: []*proto.KeyColumn{
+				{Name: "id", Operators: []string{"="}, Require: "optional"},
+			},
+		},
+	}
+	// the hidden cache ttl column follows the columns of the table
+	const cacheTTLColumn = 2
+	colUsed := int64(1)
+
+	tests := []struct {
+		name        string
+		constraints []*sqlite.IndexConstraint
+		wantUsage   []sqlite.ConstraintUsage
+		wantArgvIdx int
+		wantErr     string
+	}{
+		{
+			"= is consumed",
+			[]*sqlite.IndexConstraint{{ColumnIndex: cacheTTLColumn, Op: sqlite.INDEX_CONSTRAINT_EQ, Usable: true}},
+			[]sqlite.ConstraintUsage{{ArgvIndex: 1, Omit: true}},
+			1,
+			"",
+		},
+		{
+			"= with a key column qual",
+			[]*sqlite.IndexConstraint{
+				{ColumnIndex: 0, Op: sqlite.INDEX_CONSTRAINT_EQ, Usable: true},
+				{ColumnIndex: cacheTTLColumn, Op: sqlite.INDEX_CONSTRAINT_EQ, Usable: true},
+			},
+			[]sqlite.ConstraintUsage{{ArgvIndex: 1, Omit: false}, {ArgvIndex: 2, Omit: true}},
+			2,
+			"",
+		},
+		{
+			"unusable constraint is ignored",
+			[]*sqlite.IndexConstraint{{ColumnIndex: cacheTTLColumn, Op: sqlite.INDEX_CONSTRAINT_EQ, Usable: false}},
+			[]sqlite.ConstraintUsage{{ArgvIndex: -1, Omit: true}},
+			0,
+			"",
+		},
+		{
+			"> is refused",
+			[]*sqlite.IndexConstraint{{ColumnIndex: cacheTTLColumn, Op: sqlite.INDEX_CONSTRAINT_GT, Usable: true}},
+			nil,
+			0,
+			"only supports the = operator",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := table.BestIndex(&sqlite.IndexInfoInput{Constraints: tt.constraints, ColUsed: &colUsed})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("BestIndex() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BestIndex() error = %v", err)
+			}
+			for i, want := range tt.wantUsage {
+				if got := *output.ConstraintUsage[i]; got != want {
+					t.Errorf("constraint %d usage = %+v, want %+v", i, got, want)
+				}
+			}
+			qc := new(QueryContext)
+			if err := json.Unmarshal([]byte(output.IndexString), qc); err != nil {
+				t.Fatal(err)
+			}
+			var argvIdx int
+			if qc.CacheTTL != nil {
+				argvIdx = qc.CacheTTL.ArgvIdx
+			}
+			if argvIdx != tt.wantArgvIdx {
+				t.Errorf("cache ttl argv index = %d, want %d", argvIdx, tt.wantArgvIdx)
+			}
+			if len(qc.Dropped) > 0 {
+				t.Errorf("dropped quals = %v, want the cache ttl consumed", qc.Dropped)
+			}
+		})
+	}
+}
+
+func TestGetSortOrder(t *testing.T) {
+	setTestCacheConnections(t)
+	tableSchema := &proto.TableSchema{
+		Columns: []*proto.ColumnDefinition{
+			{Name: "id", Type: proto.ColumnType_STRING, SortOrder: proto.SortOrder_All},
+			{Name: "created", Type: proto.ColumnType_TIMESTAMP, SortOrder: proto.SortOrder_Asc},
+			{Name: "name", Type: proto.ColumnType_STRING},
+		},
+	}
+	// the hidden cache ttl column follows the columns of the table
+	const cacheTTLColumn = 3
+
+	tests := []struct {
+		name       string
+		connection string
+		orderBy    []*sqlite.OrderBy
+		want       []*proto.SortColumn
+		wantOk     bool
+	}{
+		{"no order by", "prod", nil, nil, false},
+		{"column which sorts both ways", "prod", []*sqlite.OrderBy{{ColumnIndex: 0, Desc: true}}, []*proto.SortColumn{{Column: "id", Order: proto.SortOrder_Desc}}, true},
+		{"column which only sorts ascending", "prod", []*sqlite.OrderBy{{ColumnIndex: 1}}, []*proto.SortColumn{{Column: "created", Order: proto.SortOrder_Asc}}, true},
+		{
+			"several columns",
+			"prod",
+			[]*sqlite.OrderBy{{ColumnIndex: 1}, {ColumnIndex: 0}},
+			[]*proto.SortColumn{{Column: "created", Order: proto.SortOrder_Asc}, {Column: "id", Order: proto.SortOrder_Asc}},
+			true,
+		},
+		{"descending on a column which only sorts ascending", "prod", []*sqlite.OrderBy{{ColumnIndex: 1, Desc: true}}, nil, false},
+		{"column which does not sort", "prod", []*sqlite.OrderBy{{ColumnIndex: 0}, {ColumnIndex: 2}}, nil, false},
+		{"rowid", "prod", []*sqlite.OrderBy{{ColumnIndex: -1}}, nil, false},
+		{"cache ttl column", "prod", []*sqlite.OrderBy{{ColumnIndex: cacheTTLColumn}}, nil, false},
+		{"aggregator", "all", []*sqlite.OrderBy{{ColumnIndex: 0}}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &PluginTable{name: "test_table", connection: tt.connection, tableSchema: tableSchema}
+			got, ok := table.getSortOrder(&sqlite.IndexInfoInput{OrderBy: tt.orderBy})
+			if ok != tt.wantOk {
+				t.Fatalf("getSortOrder() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !slices.EqualFunc(got, tt.want, func(a, b *proto.SortColumn) bool { return goproto.Equal(a, b) }) {
+				t.Errorf("getSortOrder() = %v, want %v", got, tt.want)
+			}
+
+			// SQLite only skips sorting the rows if the plugin sorts them
+			colUsed := int64(1)
+			output, err := table.BestIndex(&sqlite.IndexInfoInput{OrderBy: tt.orderBy, ColUsed: &colUsed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output.OrderByConsumed != tt.wantOk {
+				t.Errorf("BestIndex() OrderByConsumed = %v, want %v", output.OrderByConsumed, tt.wantOk)
+			}
+		})
+	}
+	t.Run("the sort order is sent to the plugin", func(t *testing.T) {
+		sortOrder := []*proto.SortColumn{{Column: "id", Order: proto.SortOrder_Desc}}
+		cursor := &PluginCursor{table: &PluginTable{name: "test_table", connection: "prod", tableSchema: tableSchema}}
+		req := cursor.buildExecuteRequest("prod", &QueryContext{SortOrder: sortOrder}, nil)
+		if got := req.QueryContext.GetSortOrder(); !slices.EqualFunc(got, sortOrder, func(a, b *proto.SortColumn) bool { return goproto.Equal(a, b) }) {
+			t.Errorf("the sort order of the request = %v, want %v", got, sortOrder)
+		}
+	})
+}
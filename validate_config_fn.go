@@ -0,0 +1,146 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/schema"
+	"go.riyazali.net/sqlite"
+)
+
+// the summaries of the diagnostics which HCL raises for arguments and blocks which are not in the schema
+var unknownConfigKeySummaries = []string{"Unsupported argument", "Unsupported block type", "Extraneous JSON object property"}
+
+// the name of the unknown key is the first quoted string in the detail of the diagnostic
+var unknownConfigKeyRegex = regexp.MustCompile(`"([^"]+)"`)
+
+// ConfigValidationResult is the result of validating a connection config
+type ConfigValidationResult struct {
+	Valid       bool     `json:"valid"`
+	Errors      []string `json:"errors"`
+	UnknownKeys []string `json:"unknown_keys"`
+}
+
+// ValidateConfigFn implements a custom scalar sql function
+// that validates a connection config against the connection config schema of the plugin
+// the config is not applied
+type ValidateConfigFn struct{}
+
+func NewValidateConfigFn() *ValidateConfigFn {
+	return &ValidateConfigFn{}
+}
+
+func (m *ValidateConfigFn) Args() int           { return 1 }
+func (m *ValidateConfigFn) Deterministic() bool { return false }
+func (m *ValidateConfigFn) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	log.Println("[TRACE] ValidateConfigFn.Apply start")
+	defer log.Println("[TRACE] ValidateConfigFn.Apply end")
+
+	var config string
+	switch values[0].Type() {
+	case sqlite.SQLITE_TEXT:
+		config = values[0].Text()
+	case sqlite.SQLITE_BLOB:
+		config = string(values[0].Blob())
+	default:
+		ctx.ResultError(errors.New("expected a TEXT or BLOB argument"))
+		return
+	}
+
+	setJSONResult(ctx, validateConnectionConfig(config))
+}
+
+// validateConnectionConfig parses the config in the same way as the plugin does - as HCL, or else as JSON -
+// and decodes it with the connection config schema of the plugin
+func validateConnectionConfig(config string) *ConfigValidationResult {
+	log.Println("[TRACE] validateConnectionConfig start")
+	defer log.Println("[TRACE] validateConnectionConfig end")
+
+	res := &ConfigValidationResult{
+		Errors:      []string{},
+		UnknownKeys: []string{},
+	}
+
+	file, diags := hclsyntax.ParseConfig([]byte(config), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		jsonFile, jsonDiags := hcljson.Parse([]byte(config), "")
+		// report the errors of the format the config is most likely written in
+		if !jsonDiags.HasErrors() || strings.HasPrefix(strings.TrimSpace(config), "{") {
+			file, diags = jsonFile, jsonDiags
+		}
+	}
+	if !diags.HasErrors() {
+		diags = decodeConnectionConfig(file.Body)
+	}
+
+	// the diagnostics of the decoded attributes are in no particular order - report them in the order of the config
+	slices.SortStableFunc(diags, func(a, b *hcl.Diagnostic) int {
+		return cmp.Compare(getDiagnosticOffset(a), getDiagnosticOffset(b))
+	})
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+		if slices.Contains(unknownConfigKeySummaries, diag.Summary) {
+			if match := unknownConfigKeyRegex.FindStringSubmatch(diag.Detail); match != nil {
+				res.UnknownKeys = append(res.UnknownKeys, match[1])
+			}
+		}
+		res.Errors = append(res.Errors, formatConfigDiagnostic(diag))
+	}
+	res.Valid = len(res.Errors) == 0
+	return res
+}
+
+// connectionConfigSchema returns the connection config schema of the served plugin
+func connectionConfigSchema() *plugin.ConnectionConfigSchema {
+	if pluginInstance == nil {
+		return nil
+	}
+	return pluginInstance.ConnectionConfigSchema
+}
+
+// decodeConnectionConfig decodes the config body with the connection config schema of the plugin
+// a plugin which does not define a connection config schema does not accept any config
+func decodeConnectionConfig(body hcl.Body) hcl.Diagnostics {
+	configSchema := connectionConfigSchema()
+	if configSchema == nil {
+		return gohcl.DecodeBody(body, nil, &struct{}{})
+	}
+	if configSchema.Schema != nil {
+		// legacy plugins describe their config with a cty schema
+		_, diags := hcldec.Decode(body, schema.SchemaToObjectSpec(configSchema.Schema), nil)
+		return diags
+	}
+	return gohcl.DecodeBody(body, nil, configSchema.NewInstance())
+}
+
+// getDiagnosticOffset returns the position of a diagnostic in the config, diagnostics without a position come first
+func getDiagnosticOffset(diag *hcl.Diagnostic) int {
+	if diag.Subject == nil {
+		return -1
+	}
+	return diag.Subject.Start.Byte
+}
+
+func formatConfigDiagnostic(diag *hcl.Diagnostic) string {
+	msg := diag.Summary
+	if diag.Detail != "" {
+		msg = fmt.Sprintf("%s: %s", diag.Summary, diag.Detail)
+	}
+	if diag.Subject != nil {
+		msg = fmt.Sprintf("line %d, column %d: %s", diag.Subject.Start.Line, diag.Subject.Start.Column, msg)
+	}
+	return msg
+}
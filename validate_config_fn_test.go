@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+type testConnectionConfig struct {
+	Profile string   `hcl:"profile"`
+	Regions []string `hcl:"regions,optional"`
+}
+
+// setPluginInstance sets the served plugin for the duration of the test
+func setPluginInstance(t *testing.T, p *plugin.Plugin) {
+	t.Helper()
+	previous := pluginInstance
+	pluginInstance = p
+	t.Cleanup(func() { pluginInstance = previous })
+}
+
+func TestRegisterPlugin(t *testing.T) {
+	setPluginInstance(t, nil)
+	p := &plugin.Plugin{Name: "test"}
+	calls := 0
+	pluginFunc := registerPlugin(func(context.Context) *plugin.Plugin {
+		calls++
+		return p
+	})
+	if got := pluginFunc(context.Background()); got != p {
+		t.Fatalf("registerPlugin() returned %v, want the created plugin", got)
+	}
+	if pluginInstance != p || calls != 1 {
+		t.Errorf("registerPlugin() did not capture the plugin it created once: instance %v, calls %d", pluginInstance, calls)
+	}
+}
+
+func TestValidateConnectionConfig(t *testing.T) {
+	setPluginInstance(t, &plugin.Plugin{
+		Name: "test",
+		ConnectionConfigSchema: &plugin.ConnectionConfigSchema{
+			NewInstance: func() any { return &testConnectionConfig{} },
+		},
+	})
+
+	tests := []struct {
+		name            string
+		config          string
+		wantValid       bool
+		wantUnknownKeys []string
+	}{
+		{"valid hcl", `profile = "prod"` + "\n" + `regions = ["us-east-1"]`, true, nil},
+		{"valid json", `{"profile": "prod", "regions": ["us-east-1"]}`, true, nil},
+		{"invalid hcl", `profile = "prod`, false, nil},
+		{"invalid json", `{"profile": "prod",}`, false, nil},
+		{"missing required key", `regions = ["us-east-1"]`, false, nil},
+		{"unknown keys", `profile = "prod"` + "\n" + `region = "us-east-1"` + "\n" + `token = "x"`, false, []string{"region", "token"}},
+		{"unknown json key", `{"profile": "prod", "region": "us-east-1"}`, false, []string{"region"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := validateConnectionConfig(tt.config)
+			if res.Valid != tt.wantValid {
+				t.Fatalf("validateConnectionConfig(%q) valid = %v, want %v (errors %q)", tt.config, res.Valid, tt.wantValid, res.Errors)
+			}
+			if !tt.wantValid && len(res.Errors) == 0 {
+				t.Errorf("validateConnectionConfig(%q) returned no errors", tt.config)
+			}
+			if !slices.Equal(res.UnknownKeys, tt.wantUnknownKeys) {
+				t.Errorf("validateConnectionConfig(%q) unknown keys = %q, want %q", tt.config, res.UnknownKeys, tt.wantUnknownKeys)
+			}
+		})
+	}
+
+	t.Run("plugin without a config schema", func(t *testing.T) {
+		setPluginInstance(t, &plugin.Plugin{Name: "test"})
+		if res := validateConnectionConfig(""); !res.Valid {
+			t.Errorf("an empty config is invalid: %q", res.Errors)
+		}
+		if res := validateConnectionConfig(`profile = "prod"`); res.Valid || !slices.Equal(res.UnknownKeys, []string{"profile"}) {
+			t.Errorf("config accepted without a config schema: valid %v, unknown keys %q", res.Valid, res.UnknownKeys)
+		}
+	})
+}
+
+func TestIsGetOnlyTable(t *testing.T) {
+	hydrate := func(context.Context, *plugin.QueryData, *plugin.HydrateData) (any, error) { return nil, nil }
+	setPluginInstance(t, &plugin.Plugin{
+		Name: "test",
+		TableMap: map[string]*plugin.Table{
+			"get_table":  {Name: "get_table", Get: &plugin.GetConfig{Hydrate: hydrate}},
+			"list_table": {Name: "list_table", List: &plugin.ListConfig{Hydrate: hydrate}, Get: &plugin.GetConfig{Hydrate: hydrate}},
+		},
+	})
+	tests := []struct {
+		table string
+		want  bool
+	}{
+		{"get_table", true},
+		{"list_table", false},
+		{"unknown_table", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			if got := isGetOnlyTable(tt.table); got != tt.want {
+				t.Errorf("isGetOnlyTable(%q) = %v, want %v", tt.table, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("no plugin", func(t *testing.T) {
+		setPluginInstance(t, nil)
+		if isGetOnlyTable("get_table") {
+			t.Error("isGetOnlyTable() = true without a plugin")
+		}
+	})
+}